@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/amoz0x/nether/internal/cache"
+	"github.com/amoz0x/nether/internal/util"
+)
+
+// cmdCache runs a cache maintenance command.
+func cmdCache(args []string) {
+	if len(args) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: missing cache command\n")
+		usage()
+	}
+
+	switch args[0] {
+	case "compact":
+		cmdCacheCompact(args[1:])
+	case "fsck":
+		cmdCacheFsck(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "Error: unknown cache command %q\n", args[0])
+		usage()
+	}
+}
+
+// cmdCacheCompact folds the append log of the given roots, or of every
+// cached root, into their shards.
+func cmdCacheCompact(args []string) {
+	fs := flag.NewFlagSet("cache compact", flag.ExitOnError)
+	quiet := fs.Bool("q", false, "Quiet mode")
+	fs.Parse(args)
+
+	c := cache.MustNew()
+	roots := cacheRoots(c, fs.Args())
+
+	failed := false
+	for _, root := range roots {
+		before := diskSize(c, root)
+		if err := c.Compact(root); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s: %v\n", root, err)
+			failed = true
+			continue
+		}
+		if !*quiet {
+			fmt.Fprintf(os.Stderr, "%s: %d -> %d bytes\n", root, before, diskSize(c, root))
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// cmdCacheFsck checks the shards, logs and deltas of the given roots, or of
+// every cached root, and with --repair salvages the broken ones.
+func cmdCacheFsck(args []string) {
+	fs := flag.NewFlagSet("cache fsck", flag.ExitOnError)
+	repair := fs.Bool("repair", false, "Salvage readable rows of broken files and quarantine the originals")
+	output := fs.String("o", "text", "Output format (text|json)")
+	quiet := fs.Bool("q", false, "Quiet mode")
+	fs.Parse(args)
+	if *output != "text" && *output != "json" {
+		fmt.Fprintf(os.Stderr, "Error: unknown output format %q\n", *output)
+		os.Exit(1)
+	}
+
+	c := cache.MustNew()
+	roots := c.FsckRoots()
+	if fs.NArg() > 0 {
+		roots = cacheRoots(c, fs.Args())
+	}
+
+	failed := false
+	all := []*cache.FileReport{}
+	files, problems, repaired := 0, 0, 0
+	for _, root := range roots {
+		reports, err := c.Fsck(root, *repair)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s: %v\n", root, err)
+			failed = true
+		}
+		for _, r := range reports {
+			files++
+			problems += len(r.Problems)
+			if len(r.Problems) > 0 && !r.Repaired {
+				failed = true
+			}
+			if r.Repaired {
+				repaired++
+			}
+		}
+		all = append(all, reports...)
+	}
+
+	if *output == "json" {
+		data, err := json.MarshalIndent(all, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: failed to marshal JSON: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(data))
+	} else {
+		for _, r := range all {
+			printFileReport(r, *quiet)
+		}
+	}
+
+	if !*quiet {
+		fmt.Fprintf(os.Stderr, "Checked %d files of %d roots: %d problems", files, len(roots), problems)
+		if *repair {
+			fmt.Fprintf(os.Stderr, ", %d files repaired", repaired)
+		} else if problems > 0 {
+			fmt.Fprintf(os.Stderr, ", run with --repair to fix them")
+		}
+		fmt.Fprintln(os.Stderr)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// printFileReport prints the problems found in a file and how it was
+// repaired. Healthy files are only listed when quiet is unset.
+func printFileReport(r *cache.FileReport, quiet bool) {
+	name := filepath.Base(r.Path)
+	if len(r.Problems) == 0 {
+		if !quiet {
+			fmt.Printf("%s: %d rows, ok\n", name, r.Rows)
+		}
+		return
+	}
+
+	fmt.Printf("%s: %d rows, %d problems\n", name, r.Rows, len(r.Problems))
+	for _, p := range r.Problems {
+		var where []string
+		if p.Line > 0 {
+			where = append(where, fmt.Sprintf("line %d", p.Line))
+		}
+		if p.Sub != "" {
+			where = append(where, p.Sub)
+		}
+		if len(where) > 0 {
+			fmt.Printf("  %s: %s\n", strings.Join(where, " "), p.Issue)
+		} else {
+			fmt.Printf("  %s\n", p.Issue)
+		}
+	}
+	switch {
+	case r.Quarantined != "":
+		fmt.Printf("  repaired, original moved to %s\n", r.Quarantined)
+	case r.Repaired:
+		fmt.Printf("  repaired\n")
+	}
+}
+
+// cacheRoots returns the roots named on the command line, or every cached
+// root when none are.
+func cacheRoots(c *cache.Cache, args []string) []string {
+	if len(args) == 0 {
+		return c.ListDomains()
+	}
+
+	var roots []string
+	for _, arg := range args {
+		root := util.NormalizeHost(arg)
+		if root == "" {
+			fmt.Fprintf(os.Stderr, "Error: invalid root domain %q\n", arg)
+			os.Exit(1)
+		}
+		roots = append(roots, root)
+	}
+	return roots
+}
+
+// diskSize returns the bytes taken by the shard and log of root.
+func diskSize(c *cache.Cache, root string) int64 {
+	var size int64
+	for _, path := range []string{c.CachePath(root), c.LogPath(root)} {
+		if info, err := os.Stat(path); err == nil {
+			size += info.Size()
+		}
+	}
+	return size
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/amoz0x/nether/internal/cache"
+)
+
+// diffJSON is the JSON output form of a diff.
+type diffJSON struct {
+	Root    string      `json:"root"`
+	From    string      `json:"from"`
+	To      string      `json:"to"`
+	Added   []cache.Row `json:"added"`
+	Removed []cache.Row `json:"removed"`
+}
+
+// cmdDiff prints the subdomains that changed for a root between two points in time.
+func cmdDiff(args []string) {
+	var root string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		root = args[0]
+		args = args[1:]
+	}
+
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	output := fs.String("o", "text", "Output format (text|json)")
+	since := fs.String("since", "7d", "Show changes within this long before --to (e.g. 12h, 7d, 2w)")
+	fromFlag := fs.String("from", "", "Start of the window (RFC 3339 or YYYY-MM-DD)")
+	toFlag := fs.String("to", "", "End of the window (RFC 3339 or YYYY-MM-DD, default: now)")
+	scopeFile := fs.String("scope", "", "Scope file applied on top of ~/.nether/scopes/<root>.scope")
+	exactRoot := fs.Bool("exact-root", false, "Use the root as given instead of its registrable domain")
+	quiet := fs.Bool("q", false, "Quiet mode")
+	fs.Parse(args)
+	if root == "" && fs.NArg() > 0 {
+		root = fs.Arg(0)
+	}
+
+	if root == "" {
+		fmt.Fprintf(os.Stderr, "Error: missing root domain\n")
+		usage()
+	}
+	root, err := registrableRoot(root, *exactRoot, *quiet)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if *output != "text" && *output != "json" {
+		fmt.Fprintf(os.Stderr, "Error: unknown output format %q\n", *output)
+		os.Exit(1)
+	}
+
+	sinceSet := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "since" {
+			sinceSet = true
+		}
+	})
+	if sinceSet && *fromFlag != "" {
+		fmt.Fprintf(os.Stderr, "Error: --since and --from are mutually exclusive\n")
+		os.Exit(1)
+	}
+
+	to := time.Now().UTC()
+	if *toFlag != "" {
+		ts, err := parseTimestamp(*toFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid --to: %v\n", err)
+			os.Exit(1)
+		}
+		to = ts
+	}
+
+	var from time.Time
+	if *fromFlag != "" {
+		ts, err := parseTimestamp(*fromFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid --from: %v\n", err)
+			os.Exit(1)
+		}
+		from = ts
+	} else {
+		d, err := parseSince(*since)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid --since: %v\n", err)
+			os.Exit(1)
+		}
+		from = to.Add(-d)
+	}
+	if from.After(to) {
+		fmt.Fprintf(os.Stderr, "Error: --from is after --to\n")
+		os.Exit(1)
+	}
+
+	c := cache.MustNew()
+	setScopeFile(c, *scopeFile)
+	diff, err := c.Diff(root, from, to)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	sc := scopeFor(c, root)
+	diff.Added = sc.FilterRows(diff.Added)
+	diff.Removed = sc.FilterRows(diff.Removed)
+
+	if *output == "json" {
+		out := diffJSON{
+			Root:    diff.Root,
+			From:    diff.From.Format(time.RFC3339),
+			To:      diff.To.Format(time.RFC3339),
+			Added:   diff.Added,
+			Removed: diff.Removed,
+		}
+		if out.Added == nil {
+			out.Added = []cache.Row{}
+		}
+		if out.Removed == nil {
+			out.Removed = []cache.Row{}
+		}
+		data, err := json.MarshalIndent(out, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: failed to marshal JSON: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(data))
+	} else {
+		for _, row := range diff.Added {
+			fmt.Printf("+ %s\n", row.Sub)
+		}
+		for _, row := range diff.Removed {
+			fmt.Printf("- %s\n", row.Sub)
+		}
+	}
+
+	if !*quiet {
+		fmt.Fprintf(os.Stderr, "%s: %d added, %d removed between %s and %s\n", root, len(diff.Added), len(diff.Removed),
+			diff.From.Format(time.RFC3339), diff.To.Format(time.RFC3339))
+	}
+}
+
+// parseSince parses a duration, additionally accepting whole days (d) and weeks (w).
+func parseSince(s string) (time.Duration, error) {
+	unit := time.Duration(0)
+	switch {
+	case strings.HasSuffix(s, "d"):
+		unit = 24 * time.Hour
+	case strings.HasSuffix(s, "w"):
+		unit = 7 * 24 * time.Hour
+	}
+	if unit != 0 {
+		n, err := strconv.Atoi(strings.TrimSuffix(strings.TrimSuffix(s, "d"), "w"))
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("bad duration %q", s)
+		}
+		return time.Duration(n) * unit, nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("negative duration %q", s)
+	}
+	return d, nil
+}
+
+// parseTimestamp accepts RFC 3339 timestamps, dates, and the compact form
+// used in delta file names. Times without a zone are taken as UTC.
+func parseTimestamp(s string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02", "20060102T150405"} {
+		if ts, err := time.Parse(layout, s); err == nil {
+			return ts.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognized timestamp %q", s)
+}
@@ -8,12 +8,13 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/amoz0x/nether/internal/cache"
-	"github.com/amoz0x/nether/internal/merge"
 	"github.com/amoz0x/nether/internal/p2p"
 	"github.com/amoz0x/nether/internal/scan"
+	"github.com/amoz0x/nether/internal/util"
 )
 
 const Version = "v0.1.0"
@@ -22,15 +23,49 @@ func usage() {
 	fmt.Fprintf(os.Stderr, "blink %s - Decentralized subdomain enumeration with IPFS caching\n\n", Version)
 	fmt.Fprintf(os.Stderr, "Usage:\n")
 	fmt.Fprintf(os.Stderr, "  blink sub <root> [flags]\n")
+	fmt.Fprintf(os.Stderr, "  blink sub -l <roots.txt|-> [flags]\n")
+	fmt.Fprintf(os.Stderr, "  blink resolve <root> [--alive] [--resolvers list] [-o format]\n")
+	fmt.Fprintf(os.Stderr, "  blink probe <root> [--ports 80,443,8080] [-o format]\n")
+	fmt.Fprintf(os.Stderr, "  blink takeover <root> [--fingerprints file] [-o text|json]\n")
+	fmt.Fprintf(os.Stderr, "  blink diff <root> [--since 7d | --from <ts> --to <ts>] [-o text|json]\n")
 	fmt.Fprintf(os.Stderr, "  blink sync [flags]\n")
 	fmt.Fprintf(os.Stderr, "  blink status [flags]\n")
+	fmt.Fprintf(os.Stderr, "  blink cache compact [root...]\n")
+	fmt.Fprintf(os.Stderr, "  blink cache fsck [--repair] [-o text|json] [root...]\n")
 	fmt.Fprintf(os.Stderr, "  blink --version\n")
 	fmt.Fprintf(os.Stderr, "  blink --help\n\n")
 	fmt.Fprintf(os.Stderr, "Flags:\n")
 	fmt.Fprintf(os.Stderr, "  --rescan          Force fresh scan even if cache exists\n")
 	fmt.Fprintf(os.Stderr, "  --network         Enable decentralized network mode (default: true)\n")
 	fmt.Fprintf(os.Stderr, "  --publish         Publish results to decentralized network (default: true)\n")
-	fmt.Fprintf(os.Stderr, "  -o json|text      Output format (default: text)\n")
+	fmt.Fprintf(os.Stderr, "  -o format         Output format: text, json, jsonl or csv (default: text)\n")
+	fmt.Fprintf(os.Stderr, "  --full            Emit complete cache rows in json and jsonl output\n")
+	fmt.Fprintf(os.Stderr, "  --unicode         Display internationalized subdomains in Unicode (stored as punycode)\n")
+	fmt.Fprintf(os.Stderr, "  --sources list    Comma-separated discovery sources (default: subfinder)\n")
+	fmt.Fprintf(os.Stderr, "                    Available: %s\n", strings.Join(scan.Names(), ", "))
+	fmt.Fprintf(os.Stderr, "  --brute           Shorthand for adding brute to --sources\n")
+	fmt.Fprintf(os.Stderr, "  --permute         Also resolve permutations of known subdomains (dev/stage/prod swaps, numbers, words)\n")
+	fmt.Fprintf(os.Stderr, "  --ptr-sweep       Also look up PTR records in the ranges around resolved subdomains\n")
+	fmt.Fprintf(os.Stderr, "  --ptr-prefix n    IPv4 prefix length of the swept ranges (default: 24)\n")
+	fmt.Fprintf(os.Stderr, "  --ptr-prefix6 n   IPv6 prefix length of the swept ranges (default: 120)\n")
+	fmt.Fprintf(os.Stderr, "  --wordlist file   Wordlist for --brute and --permute (default: bundled quick list)\n")
+	fmt.Fprintf(os.Stderr, "  --depth n         Recurse into dense sub-zones up to n labels below the root (default: 0)\n")
+	fmt.Fprintf(os.Stderr, "  --recurse-min n   Hosts a sub-zone needs before it is scanned on its own (default: 5)\n")
+	fmt.Fprintf(os.Stderr, "  --tls-ports list  Ports the tls source reads certificates from (default: 443)\n")
+	fmt.Fprintf(os.Stderr, "  --resolvers list  Comma-separated DNS resolvers (default: public resolvers)\n")
+	fmt.Fprintf(os.Stderr, "  --workers n       Concurrent DNS lookups (default: 50)\n")
+	fmt.Fprintf(os.Stderr, "  --qps n           Max DNS queries per second across all sources and roots, 0 for unlimited (default: 200)\n")
+	fmt.Fprintf(os.Stderr, "  --wildcard-filter Drop results explained by wildcard DNS (default: true)\n")
+	fmt.Fprintf(os.Stderr, "  --source-filter l Only show subdomains reported by these sources (e.g. crtsh,brute)\n")
+	fmt.Fprintf(os.Stderr, "  --scope file      Scope file for every root, on top of ~/.nether/scopes/<root>.scope\n")
+	fmt.Fprintf(os.Stderr, "  --exact-root      Scan roots as given; by default www.example.com becomes example.com\n")
+	fmt.Fprintf(os.Stderr, "  --include-stale   Also show hosts missed by recent scans (stale or removed)\n")
+	fmt.Fprintf(os.Stderr, "  --resolve         Resolve A/AAAA/CNAME records of every host and store them\n")
+	fmt.Fprintf(os.Stderr, "  --alive           Only show hosts that resolved to an address\n")
+	fmt.Fprintf(os.Stderr, "  --probed          Only show hosts that answered blink probe, with their responses\n")
+	fmt.Fprintf(os.Stderr, "  --timeout d       Maximum scan duration per root, partial results are kept (default: 5m)\n")
+	fmt.Fprintf(os.Stderr, "  -l file           Batch mode: read roots from file, one per line (- for stdin)\n")
+	fmt.Fprintf(os.Stderr, "  -c n              Roots scanned concurrently in batch mode (default: 4)\n")
 	fmt.Fprintf(os.Stderr, "  -q                Quiet mode (suppress progress messages)\n\n")
 	fmt.Fprintf(os.Stderr, "Auto-Sync:\n")
 	fmt.Fprintf(os.Stderr, "  • Automatically syncs with global network on first run\n")
@@ -39,10 +74,26 @@ func usage() {
 	fmt.Fprintf(os.Stderr, "Examples:\n")
 	fmt.Fprintf(os.Stderr, "  blink sub example.com                     # Smart mode: network -> cache -> scan\n")
 	fmt.Fprintf(os.Stderr, "  blink sub example.com --rescan           # Force fresh scan + publish to network\n")
+	fmt.Fprintf(os.Stderr, "  blink sub example.com --brute            # Add DNS brute-force to the scan\n")
+	fmt.Fprintf(os.Stderr, "  blink sub example.com --sources subfinder,amass,brute\n")
+	fmt.Fprintf(os.Stderr, "  blink sub example.com --permute          # Find siblings of cached hosts\n")
+	fmt.Fprintf(os.Stderr, "  blink sub example.com --ptr-sweep        # Reverse DNS of neighbouring IPs\n")
+	fmt.Fprintf(os.Stderr, "  blink sub example.com --depth 2          # Also scan dense sub-zones like corp.example.com\n")
+	fmt.Fprintf(os.Stderr, "  blink sub example.com --sources subfinder,tls --tls-ports 443,8443\n")
+	fmt.Fprintf(os.Stderr, "  blink sub example.com --sources axfr,nsec  # Try zone transfers and NSEC walking\n")
 	fmt.Fprintf(os.Stderr, "  blink status                              # Check IPFS and network status\n")
 	fmt.Fprintf(os.Stderr, "  BLINK_NO_AUTO_SYNC=1 blink sub test.com  # Disable auto-sync for this run\n")
 	fmt.Fprintf(os.Stderr, "  blink sub example.com --network=false    # Disable network, use local only\n")
-	fmt.Fprintf(os.Stderr, "  blink sub example.com -o json            # JSON output\n\n")
+	fmt.Fprintf(os.Stderr, "  blink sub example.com -o json            # JSON output\n")
+	fmt.Fprintf(os.Stderr, "  blink sub example.com -o csv             # CSV with timestamps and sources\n")
+	fmt.Fprintf(os.Stderr, "  blink sub example.com -o jsonl --full    # One complete cache row per line\n")
+	fmt.Fprintf(os.Stderr, "  blink sub example.com --source-filter crtsh\n")
+	fmt.Fprintf(os.Stderr, "  blink sub -l roots.txt --scope program.scope\n")
+	fmt.Fprintf(os.Stderr, "  blink sub -l roots.txt -c 8 -o json      # Batch scan, results tagged by root\n")
+	fmt.Fprintf(os.Stderr, "  blink sub example.com --resolve --alive  # Only hosts that resolve\n")
+	fmt.Fprintf(os.Stderr, "  blink probe example.com --ports 80,443,8443\n")
+	fmt.Fprintf(os.Stderr, "  blink takeover example.com               # Dangling CNAMEs to unclaimed services\n")
+	fmt.Fprintf(os.Stderr, "  blink diff example.com --since 7d        # Subdomains added in the last week\n\n")
 	fmt.Fprintf(os.Stderr, "Cache location: ~/.blink/cache/\n")
 	fmt.Fprintf(os.Stderr, "Manifest: ~/.blink/manifest.json\n")
 	os.Exit(2)
@@ -115,7 +166,7 @@ func getLastSync(c *cache.Cache) time.Time {
 func updateLastSync(c *cache.Cache) {
 	syncFile := filepath.Join(c.Base, "last_sync")
 	timestamp := time.Now().Format(time.RFC3339)
-	os.WriteFile(syncFile, []byte(timestamp), 0644)
+	util.WriteFileAtomic(syncFile, []byte(timestamp))
 }
 
 func main() {
@@ -123,8 +174,8 @@ func main() {
 		usage()
 	}
 
-	// Auto-sync on startup (skip for version/help/status commands)
-	if os.Args[1] != "--version" && os.Args[1] != "--help" && os.Args[1] != "-h" && os.Args[1] != "status" {
+	// Auto-sync on startup (skip for version/help/status and local-only commands)
+	if os.Args[1] != "--version" && os.Args[1] != "--help" && os.Args[1] != "-h" && os.Args[1] != "status" && os.Args[1] != "diff" && os.Args[1] != "resolve" && os.Args[1] != "takeover" && os.Args[1] != "probe" && os.Args[1] != "cache" {
 		autoSync()
 	}
 
@@ -140,171 +191,26 @@ func main() {
 			usage()
 		}
 		cmdSub(os.Args[2:])
+	case "resolve":
+		cmdResolve(os.Args[2:])
+	case "probe":
+		cmdProbe(os.Args[2:])
+	case "takeover":
+		cmdTakeover(os.Args[2:])
+	case "diff":
+		cmdDiff(os.Args[2:])
 	case "sync":
 		cmdSync(os.Args[2:])
 	case "status":
 		cmdStatus(os.Args[2:])
+	case "cache":
+		cmdCache(os.Args[2:])
 	default:
 		fmt.Fprintf(os.Stderr, "Error: unknown command %q\n", os.Args[1])
 		usage()
 	}
 }
 
-func cmdSub(args []string) {
-	if len(args) == 0 {
-		fmt.Fprintf(os.Stderr, "Error: missing root domain\n")
-		usage()
-	}
-
-	startTime := time.Now()
-	root := args[0]
-	args = args[1:]
-
-	// Parse flags
-	fs := flag.NewFlagSet("sub", flag.ExitOnError)
-	output := fs.String("o", "text", "Output format (text|json)")
-	quiet := fs.Bool("q", false, "Quiet mode")
-	forceRescan := fs.Bool("rescan", false, "Force fresh scan even if cache exists")
-	networkMode := fs.Bool("network", true, "Enable decentralized network mode")
-	publishMode := fs.Bool("publish", true, "Publish results to decentralized network")
-
-	fs.Parse(args)
-
-	// Create cache and decentralized network
-	c := cache.MustNew()
-	network := p2p.NewNetworkDB(c)
-
-	var added []merge.Row
-
-	// Strategy 1: Try decentralized network first (if enabled)
-	if *networkMode {
-		if subs, err := network.QueryDomain(root); err == nil && len(subs) > 0 && !*forceRescan {
-			if !*quiet {
-				fmt.Fprintf(os.Stderr, "Found %d subdomains in decentralized network for %s\n", len(subs), root)
-			}
-			// Print results and exit - we found data in the network
-			switch *output {
-			case "text":
-				cache.PrintText(subs)
-			case "json":
-				cache.PrintJSON(subs)
-			default:
-				fmt.Fprintf(os.Stderr, "Error: unknown output format %q\n", *output)
-				os.Exit(1)
-			}
-			elapsed := time.Since(startTime)
-			if !*quiet {
-				fmt.Fprintf(os.Stderr, "\nTotal: %d subdomains for %s\n", len(subs), root)
-				fmt.Fprintf(os.Stderr, "Elapsed time: %dms\n", elapsed.Milliseconds())
-			}
-			return
-		}
-	}
-
-	// Strategy 2: Check local cache
-	existing, err := c.List(root)
-	hasCache := err == nil && len(existing) > 0
-
-	if hasCache && !*forceRescan {
-		// Use cached data for instant results
-		if !*quiet {
-			fmt.Fprintf(os.Stderr, "Found %d cached subdomains for %s (use --rescan for fresh scan)\n", len(existing), root)
-		}
-	} else {
-		// Strategy 3: No cache or forced rescan - run subfinder
-		if !*quiet {
-			if hasCache {
-				fmt.Fprintf(os.Stderr, "Rescanning %s with subfinder...\n", root)
-			} else {
-				fmt.Fprintf(os.Stderr, "No cache found, scanning %s with subfinder...\n", root)
-			}
-		}
-
-		found, err := scan.RunSubfinder(root)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-			os.Exit(1)
-		}
-
-		if !*quiet {
-			fmt.Fprintf(os.Stderr, "Found %d subdomains, merging with cache...\n", len(found))
-		}
-
-		var err2 error
-		added, err2 = merge.MergeFound(root, found, c, merge.SourceSubfinder)
-		if err2 != nil {
-			fmt.Fprintf(os.Stderr, "Error: %v\n", err2)
-			os.Exit(1)
-		}
-
-		if !*quiet {
-			if hasCache {
-				fmt.Fprintf(os.Stderr, "Added %d new subdomains\n", len(added))
-			} else {
-				fmt.Fprintf(os.Stderr, "Cached %d subdomains\n", len(found))
-			}
-		}
-
-		// Publish to decentralized network if we scanned new data
-		if *networkMode && *publishMode && (len(added) > 0 || !hasCache) {
-			if !*quiet {
-				fmt.Fprintf(os.Stderr, "Publishing to decentralized network...\n")
-			}
-			
-			// Get all subdomains for this domain to publish
-			allSubs, err := c.List(root)
-			if err == nil && len(allSubs) > 0 {
-				// Convert to cache.Row format for publishing
-				rows := make([]cache.Row, len(allSubs))
-				now := time.Now().Format(time.RFC3339)
-				for i, sub := range allSubs {
-					rows[i] = cache.Row{
-						Sub:       sub,
-						FirstSeen: now,
-						LastSeen:  now,
-						SrcBits:   1, // Subfinder source
-					}
-				}
-				
-				if hash, err := network.PublishDomain(root, rows); err == nil {
-					if !*quiet {
-						fmt.Fprintf(os.Stderr, "Published to network: %s\n", hash)
-					}
-				} else if !*quiet {
-					fmt.Fprintf(os.Stderr, "Warning: failed to publish to network: %v\n", err)
-				}
-			}
-		}
-	}
-
-	// Output phase
-	subs, err := c.List(root)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
-	}
-
-	switch *output {
-	case "text":
-		cache.PrintText(subs)
-	case "json":
-		cache.PrintJSON(subs)
-	default:
-		fmt.Fprintf(os.Stderr, "Error: unknown output format %q\n", *output)
-		os.Exit(1)
-	}
-
-	// Footer
-	elapsed := time.Since(startTime)
-	if !*quiet && len(subs) > 0 {
-		fmt.Fprintf(os.Stderr, "\nTotal: %d subdomains for %s\n", len(subs), root)
-		if len(added) > 0 {
-			fmt.Fprintf(os.Stderr, "New this run: %d\n", len(added))
-		}
-		fmt.Fprintf(os.Stderr, "Elapsed time: %v\n", elapsed.Round(time.Millisecond))
-	}
-}
-
 // cmdSync synchronizes with the decentralized network
 func cmdSync(args []string) {
 	startTime := time.Now()
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/amoz0x/nether/internal/cache"
+	"github.com/amoz0x/nether/internal/merge"
+	"github.com/amoz0x/nether/internal/output"
+	"github.com/amoz0x/nether/internal/probe"
+)
+
+// cmdProbe requests the cached hosts of a root over HTTP(S) and stores what
+// answered in the cache.
+func cmdProbe(args []string) {
+	startTime := time.Now()
+
+	var root string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		root = args[0]
+		args = args[1:]
+	}
+
+	fs := flag.NewFlagSet("probe", flag.ExitOnError)
+	format := fs.String("o", "text", "Output format (text|json|jsonl|csv)")
+	full := fs.Bool("full", false, "Emit complete cache rows in json and jsonl output")
+	unicode := fs.Bool("unicode", false, "Display internationalized subdomains in Unicode instead of punycode")
+	ports := fs.String("ports", probe.DefaultPorts, "Comma-separated ports, optionally as scheme:port")
+	workers := fs.Int("workers", 25, "Hosts probed concurrently")
+	timeout := fs.Duration("timeout", 10*time.Second, "Timeout per request")
+	includeStale := fs.Bool("include-stale", false, "Also probe stale subdomains")
+	scopeFile := fs.String("scope", "", "Scope file applied on top of ~/.nether/scopes/<root>.scope")
+	exactRoot := fs.Bool("exact-root", false, "Use the root as given instead of its registrable domain")
+	quiet := fs.Bool("q", false, "Quiet mode")
+	fs.Parse(args)
+	if root == "" && fs.NArg() > 0 {
+		root = fs.Arg(0)
+	}
+
+	if root == "" {
+		fmt.Fprintf(os.Stderr, "Error: missing root domain\n")
+		usage()
+	}
+	root, err := registrableRoot(root, *exactRoot, *quiet)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if !output.Valid(*format) {
+		fmt.Fprintf(os.Stderr, "Error: unknown output format %q\n", *format)
+		os.Exit(1)
+	}
+	targets, err := probe.ParsePorts(*ports)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid --ports: %v\n", err)
+		os.Exit(1)
+	}
+
+	c := cache.MustNew()
+	setScopeFile(c, *scopeFile)
+	sc := scopeFor(c, root)
+	rows, err := c.Rows(root)
+	if err != nil || len(rows) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: no cached subdomains for %s (run: blink sub %s)\n", root, root)
+		os.Exit(1)
+	}
+
+	// Hosts known not to resolve are skipped, as are hosts out of scope
+	var hosts []string
+	for _, row := range rows {
+		if row.State() == cache.StatusRemoved || (!*includeStale && row.State() != cache.StatusActive) {
+			continue
+		}
+		if !sc.AllowsRow(row) {
+			continue
+		}
+		if row.DNS != nil && !row.Alive() {
+			continue
+		}
+		hosts = append(hosts, row.Sub)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	prober := probe.NewProber(targets, *timeout)
+	prober.Workers = *workers
+	prober.Scope = sc
+	results := prober.ProbeAll(ctx, hosts)
+	if err := merge.SetProbes(root, results, c); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	rows, err = c.Rows(root)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	var tagged []cache.Tagged
+	for _, row := range rows {
+		if len(results[row.Sub]) > 0 {
+			tagged = append(tagged, cache.Tagged{Root: root, Row: row})
+		}
+	}
+
+	opts := output.Options{Format: *format, Full: *full, Probed: true, Unicode: *unicode}
+	if err := output.Write(os.Stdout, opts, tagged); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if !*quiet {
+		fmt.Fprintf(os.Stderr, "\nProbed %d/%d hosts for %s, %d responded\n", len(results), len(hosts), root, len(tagged))
+		fmt.Fprintf(os.Stderr, "Elapsed time: %v\n", time.Since(startTime).Round(time.Millisecond))
+	}
+}
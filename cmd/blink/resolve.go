@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/amoz0x/nether/internal/cache"
+	"github.com/amoz0x/nether/internal/dns"
+	"github.com/amoz0x/nether/internal/output"
+	"github.com/amoz0x/nether/internal/resolve"
+)
+
+// cmdResolve resolves the cached hosts of a root and prints them with their records.
+func cmdResolve(args []string) {
+	startTime := time.Now()
+
+	var root string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		root = args[0]
+		args = args[1:]
+	}
+
+	fs := flag.NewFlagSet("resolve", flag.ExitOnError)
+	format := fs.String("o", "text", "Output format (text|json|jsonl|csv)")
+	full := fs.Bool("full", false, "Emit complete cache rows in json and jsonl output")
+	unicode := fs.Bool("unicode", false, "Display internationalized subdomains in Unicode instead of punycode")
+	alive := fs.Bool("alive", false, "Only show hosts that resolved to an address")
+	includeStale := fs.Bool("include-stale", false, "Also show stale subdomains")
+	resolvers := fs.String("resolvers", "", "Comma-separated DNS resolvers")
+	workers := fs.Int("workers", 50, "Concurrent DNS lookups")
+	qps := fs.Int("qps", 200, "Max DNS queries per second (0 for unlimited)")
+	scopeFile := fs.String("scope", "", "Scope file applied on top of ~/.nether/scopes/<root>.scope")
+	exactRoot := fs.Bool("exact-root", false, "Use the root as given instead of its registrable domain")
+	quiet := fs.Bool("q", false, "Quiet mode")
+	fs.Parse(args)
+	if root == "" && fs.NArg() > 0 {
+		root = fs.Arg(0)
+	}
+
+	if root == "" {
+		fmt.Fprintf(os.Stderr, "Error: missing root domain\n")
+		usage()
+	}
+	root, err := registrableRoot(root, *exactRoot, *quiet)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if !output.Valid(*format) {
+		fmt.Fprintf(os.Stderr, "Error: unknown output format %q\n", *format)
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	c := cache.MustNew()
+	setScopeFile(c, *scopeFile)
+	if subs, err := c.List(root); err != nil || len(subs) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: no cached subdomains for %s (run: blink sub %s)\n", root, root)
+		os.Exit(1)
+	}
+
+	client := dns.NewClient(splitList(*resolvers), *qps)
+	n, err := resolve.Root(ctx, c, root, client, *workers)
+	if err != nil && !interrupted(err) {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	rows, err := c.Rows(root)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	rows = scopeFor(c, root).FilterRows(rows)
+
+	var tagged []cache.Tagged
+	live := 0
+	for _, row := range rows {
+		if row.State() == cache.StatusRemoved || (!*includeStale && row.State() != cache.StatusActive) {
+			continue
+		}
+		if row.Alive() {
+			live++
+		}
+		if *alive && !row.Alive() {
+			continue
+		}
+		tagged = append(tagged, cache.Tagged{Root: root, Row: row})
+	}
+
+	if err := output.Write(os.Stdout, output.Options{Format: *format, Full: *full, Records: true, Unicode: *unicode}, tagged); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if !*quiet {
+		fmt.Fprintf(os.Stderr, "\nResolved %d hosts for %s, %d alive\n", n, root, live)
+		fmt.Fprintf(os.Stderr, "Elapsed time: %v\n", time.Since(startTime).Round(time.Millisecond))
+	}
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/amoz0x/nether/internal/cache"
+	"github.com/amoz0x/nether/internal/dns"
+	"github.com/amoz0x/nether/internal/merge"
+	"github.com/amoz0x/nether/internal/scan"
+	"github.com/amoz0x/nether/internal/util"
+)
+
+const (
+	// checkpointEvery is the longest time results wait before being cached.
+	checkpointEvery = 2 * time.Second
+	// checkpointBatch flushes early once this many new hosts are pending.
+	checkpointBatch = 500
+	// flushGrace bounds the wildcard filtering of the last checkpoint once
+	// the scan has timed out or been interrupted.
+	flushGrace = 10 * time.Second
+)
+
+// scanStream consumes scanner results as they arrive, passing kept rows to
+// onRow and checkpointing them into the cache so an interrupted or timed-out
+// scan keeps everything found so far.
+type scanStream struct {
+	root     string
+	zone     string // Sub-zone scanned instead of root during recursion; empty for root
+	c        *cache.Cache
+	detector *dns.WildcardDetector // nil disables wildcard filtering
+	onRow    func(row cache.Row)   // Called once per kept host with its merged row; may be nil
+	quiet    bool
+
+	names   map[string]bool // Scanners started by run
+	pending map[string]*merge.Hit
+	seen    map[string]bool
+	added   []merge.Row
+	found   int
+	dropped int
+	invalid map[util.Reason]int // Reported names rejected by util.CheckHost
+}
+
+func newScanStream(root string, c *cache.Cache, detector *dns.WildcardDetector) *scanStream {
+	return &scanStream{
+		root:     root,
+		c:        c,
+		detector: detector,
+		names:    make(map[string]bool),
+		pending:  make(map[string]*merge.Hit),
+		seen:     make(map[string]bool),
+		invalid:  make(map[util.Reason]int),
+	}
+}
+
+// run executes scanners and streams their results until they finish or ctx
+// ends. Scanner failures are returned per name; a cache write failure is
+// returned as err.
+func (s *scanStream) run(ctx context.Context, scanners []scan.Scanner) (map[string]error, error) {
+	for _, sc := range scanners {
+		s.names[sc.Name()] = true
+	}
+
+	out := make(chan scan.Result)
+	errsCh := make(chan map[string]error, 1)
+	go func() {
+		errsCh <- scan.RunAll(ctx, s.target(), scanners, out)
+		close(out)
+	}()
+
+	ticker := time.NewTicker(checkpointEvery)
+	defer ticker.Stop()
+
+	var flushErr error
+	for out != nil {
+		select {
+		case r, ok := <-out:
+			if !ok {
+				out = nil
+				break
+			}
+			s.add(r)
+			if len(s.pending) >= checkpointBatch && flushErr == nil {
+				flushErr = s.flush(ctx)
+			}
+		case <-ticker.C:
+			if flushErr == nil {
+				flushErr = s.flush(ctx)
+			}
+		}
+	}
+
+	if flushErr == nil {
+		flushErr = s.flush(ctx)
+	}
+	return <-errsCh, flushErr
+}
+
+// target returns the domain the scanners run against.
+func (s *scanStream) target() string {
+	if s.zone != "" {
+		return s.zone
+	}
+	return s.root
+}
+
+// add records a result in the pending batch, counting and dropping invalid
+// names and hosts outside the scanned domain.
+func (s *scanStream) add(r scan.Result) {
+	host, reason := util.CheckHost(r.Host, s.target())
+	if reason != "" {
+		s.invalid[reason]++
+		return
+	}
+	r.Host = host
+
+	hit, ok := s.pending[r.Host]
+	if !ok {
+		hit = &merge.Hit{Sub: r.Host, Parent: s.zone}
+		s.pending[r.Host] = hit
+	}
+	hit.SrcBits |= scan.SourceBit(r.Scanner)
+	if r.Source != "" {
+		hit.Sources = append(hit.Sources, r.Source)
+	}
+}
+
+// flush filters the pending batch and merges it into the cache.
+func (s *scanStream) flush(ctx context.Context) error {
+	if len(s.pending) == 0 {
+		return nil
+	}
+
+	hosts := make([]string, 0, len(s.pending))
+	for host := range s.pending {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+
+	if s.detector != nil {
+		// The last checkpoint still filters after a timeout or Ctrl-C, but only
+		// for a short while since the interrupt is still being caught. Hosts
+		// left unchecked when it runs out are kept: later scans that don't
+		// see them age wildcard noise out, while a dropped real host is lost.
+		if ctx.Err() != nil {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(context.Background(), flushGrace)
+			defer cancel()
+		}
+		kept, dropped := s.detector.Filter(ctx, s.root, hosts)
+		hosts = kept
+		s.dropped += len(dropped)
+	}
+
+	hits := make([]merge.Hit, 0, len(hosts))
+	for _, host := range hosts {
+		hits = append(hits, *s.pending[host])
+	}
+	s.pending = make(map[string]*merge.Hit)
+
+	res, err := merge.MergeHits(s.root, hits, s.c)
+	if err != nil {
+		return err
+	}
+	s.added = append(s.added, res.Added...)
+
+	for _, row := range res.Touched {
+		if s.seen[row.Sub] {
+			continue
+		}
+		s.seen[row.Sub] = true
+		s.found++
+		if s.onRow != nil {
+			s.onRow(row)
+		}
+	}
+
+	if !s.quiet && s.onRow == nil {
+		fmt.Fprintf(os.Stderr, "Progress: %d subdomains found for %s\n", s.found, s.root)
+	}
+	return nil
+}
+
+// invalidSummary describes the rejected names by reason, e.g.
+// "3 invalid names (2 out of scope, 1 IP literal)", or returns "" when none
+// were rejected.
+func (s *scanStream) invalidSummary() string {
+	total := 0
+	var parts []string
+	for reason, n := range s.invalid {
+		total += n
+		parts = append(parts, fmt.Sprintf("%d %s", n, reason))
+	}
+	if total == 0 {
+		return ""
+	}
+	sort.Strings(parts)
+	return fmt.Sprintf("%d invalid names (%s)", total, strings.Join(parts, ", "))
+}
+
+// sweep ages the cached rows that no completed scanner reported. Scanners
+// that failed or were interrupted don't count, so a partial scan never marks
+// hosts as missing. Neither does permute: it never re-reports the known hosts
+// it derives candidates from, including those it found itself.
+func (s *scanStream) sweep(errs map[string]error) (merge.Result, error) {
+	ranBits := 0
+	for name := range s.names {
+		if errs[name] == nil && name != "permute" {
+			ranBits |= scan.SourceBit(name)
+		}
+	}
+	if ranBits == 0 {
+		return merge.Result{}, nil
+	}
+	return merge.Sweep(s.root, s.seen, ranBits, s.c)
+}
+
+// recordWildcards saves the wildcard zones seen during the scan.
+func (s *scanStream) recordWildcards() {
+	if s.detector == nil {
+		return
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	var zones []cache.WildcardZone
+	for _, w := range s.detector.Wildcards() {
+		zones = append(zones, cache.WildcardZone{Zone: w.Zone, Answers: w.Answers, DetectedAt: now})
+	}
+	if err := s.c.RecordWildcards(s.root, zones); err != nil && !s.quiet {
+		fmt.Fprintf(os.Stderr, "Warning: failed to record wildcard zones: %v\n", err)
+	}
+}
+
+// interrupted reports whether err stems from a timeout or cancellation rather
+// than a failing source.
+func interrupted(err error) bool {
+	return errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled)
+}
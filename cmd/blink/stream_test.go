@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/amoz0x/nether/internal/cache"
+	"github.com/amoz0x/nether/internal/scan"
+)
+
+// fakeScanner reports a fixed list of hosts under the name of a real source.
+type fakeScanner struct {
+	name  string
+	hosts []string
+}
+
+func (f *fakeScanner) Name() string { return f.name }
+
+func (f *fakeScanner) Run(ctx context.Context, root string, out chan<- scan.Result) error {
+	for _, host := range f.hosts {
+		out <- scan.Result{Host: host}
+	}
+	return nil
+}
+
+func TestSweepKeepsPermuteHostsAcrossRuns(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, dir := range []string{"cache", "deltas"} {
+		if err := os.MkdirAll(filepath.Join(tmpDir, dir), 0755); err != nil {
+			t.Fatalf("Failed to create %s dir: %v", dir, err)
+		}
+	}
+	c := &cache.Cache{Base: tmpDir}
+
+	// The first run finds dev through permute; later runs only see it as a
+	// seed, so permute doesn't report it again
+	runs := [][]scan.Scanner{
+		{
+			&fakeScanner{name: "subfinder", hosts: []string{"api.example.com", "old.example.com"}},
+			&fakeScanner{name: "permute", hosts: []string{"dev.example.com"}},
+		},
+	}
+	for i := 0; i < 6; i++ {
+		runs = append(runs, []scan.Scanner{
+			&fakeScanner{name: "subfinder", hosts: []string{"api.example.com"}},
+			&fakeScanner{name: "permute"},
+		})
+	}
+
+	for i, scanners := range runs {
+		stream := newScanStream("example.com", c, nil)
+		stream.quiet = true
+		errs, err := stream.run(context.Background(), scanners)
+		if err != nil {
+			t.Fatalf("Run %d failed: %v", i+1, err)
+		}
+		if _, err := stream.sweep(errs); err != nil {
+			t.Fatalf("Sweep %d failed: %v", i+1, err)
+		}
+	}
+
+	rows, err := c.Rows("example.com")
+	if err != nil {
+		t.Fatalf("Failed to read rows: %v", err)
+	}
+	want := map[string]string{
+		"api.example.com": cache.StatusActive,
+		"dev.example.com": cache.StatusActive,
+		"old.example.com": cache.StatusRemoved,
+	}
+	if len(rows) != len(want) {
+		t.Fatalf("Expected %d rows, got %+v", len(want), rows)
+	}
+	for _, row := range rows {
+		if row.State() != want[row.Sub] {
+			t.Errorf("Expected %s to be %s, got %s", row.Sub, want[row.Sub], row.State())
+		}
+	}
+}
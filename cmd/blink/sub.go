@@ -0,0 +1,846 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/amoz0x/nether/internal/cache"
+	"github.com/amoz0x/nether/internal/dns"
+	"github.com/amoz0x/nether/internal/merge"
+	"github.com/amoz0x/nether/internal/output"
+	"github.com/amoz0x/nether/internal/p2p"
+	"github.com/amoz0x/nether/internal/resolve"
+	"github.com/amoz0x/nether/internal/scan"
+	"github.com/amoz0x/nether/internal/scope"
+	"github.com/amoz0x/nether/internal/util"
+)
+
+// subOptions holds the parsed flags of the sub command.
+type subOptions struct {
+	output         string
+	full           bool
+	unicode        bool
+	exactRoot      bool
+	quiet          bool
+	forceRescan    bool
+	networkMode    bool
+	publishMode    bool
+	sources        string
+	brute          bool
+	permute        bool
+	ptrSweep       bool
+	ptrPrefix      int
+	ptrPrefix6     int
+	wordlist       string
+	resolvers      string
+	workers        int
+	qps            int
+	wildcardFilter bool
+	sourceFilter   string
+	includeStale   bool
+	resolve        bool
+	alive          bool
+	probed         bool
+	timeout        time.Duration
+	list           string
+	concurrency    int
+	tlsPorts       []int
+	depth          int
+	recurseMin     int
+	scopeFile      string
+
+	dns *dns.Client // Shared by every root and source so --qps caps the whole process
+}
+
+// subResult is the outcome of enumerating a single root.
+type subResult struct {
+	root    string
+	origin  string // Where the rows came from: network, cache or scan
+	rows    []cache.Row
+	added   []merge.Row
+	printed map[string]bool // Hosts already streamed to stdout
+	err     error
+}
+
+func cmdSub(args []string) {
+	startTime := time.Now()
+
+	// The root may come first, as in "sub example.com -o json"
+	var root string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		root = args[0]
+		args = args[1:]
+	}
+
+	// Parse flags
+	opts := &subOptions{}
+	fs := flag.NewFlagSet("sub", flag.ExitOnError)
+	fs.StringVar(&opts.output, "o", "text", "Output format (text|json|jsonl|csv)")
+	fs.BoolVar(&opts.full, "full", false, "Emit complete cache rows in json and jsonl output")
+	fs.BoolVar(&opts.unicode, "unicode", false, "Display internationalized subdomains in Unicode instead of punycode")
+	fs.BoolVar(&opts.quiet, "q", false, "Quiet mode")
+	fs.BoolVar(&opts.forceRescan, "rescan", false, "Force fresh scan even if cache exists")
+	fs.BoolVar(&opts.networkMode, "network", true, "Enable decentralized network mode")
+	fs.BoolVar(&opts.publishMode, "publish", true, "Publish results to decentralized network")
+	fs.StringVar(&opts.sources, "sources", "subfinder", "Comma-separated discovery sources")
+	fs.BoolVar(&opts.brute, "brute", false, "Also brute-force subdomains over DNS")
+	fs.BoolVar(&opts.permute, "permute", false, "Also resolve permutations of the known subdomains")
+	fs.BoolVar(&opts.ptrSweep, "ptr-sweep", false, "Also look up PTR records around the addresses of known subdomains")
+	fs.IntVar(&opts.ptrPrefix, "ptr-prefix", scan.DefaultPTRPrefix, "IPv4 prefix length of the ranges swept by --ptr-sweep")
+	fs.IntVar(&opts.ptrPrefix6, "ptr-prefix6", scan.DefaultPTRPrefix6, "IPv6 prefix length of the ranges swept by --ptr-sweep")
+	fs.StringVar(&opts.wordlist, "wordlist", "", "Wordlist for --brute and --permute (default: bundled quick list)")
+	fs.StringVar(&opts.resolvers, "resolvers", "", "Comma-separated DNS resolvers")
+	fs.IntVar(&opts.workers, "workers", 50, "Concurrent DNS lookups")
+	fs.IntVar(&opts.qps, "qps", 200, "Max DNS queries per second (0 for unlimited)")
+	fs.BoolVar(&opts.wildcardFilter, "wildcard-filter", true, "Drop results explained by wildcard DNS")
+	fs.StringVar(&opts.sourceFilter, "source-filter", "", "Only show subdomains reported by these sources")
+	fs.BoolVar(&opts.includeStale, "include-stale", false, "Also show stale and removed subdomains")
+	fs.BoolVar(&opts.resolve, "resolve", false, "Resolve A/AAAA/CNAME records of every host and store them")
+	fs.BoolVar(&opts.alive, "alive", false, "Only show hosts that resolved to an address")
+	fs.BoolVar(&opts.probed, "probed", false, "Only show hosts that answered blink probe, with their responses")
+	fs.DurationVar(&opts.timeout, "timeout", 5*time.Minute, "Maximum scan duration per root (0 for no limit)")
+	fs.StringVar(&opts.list, "l", "", "File with one root per line (- for stdin)")
+	fs.IntVar(&opts.concurrency, "c", 4, "Roots scanned concurrently in batch mode")
+	fs.IntVar(&opts.depth, "depth", 0, "Recurse into dense sub-zones up to this many labels below the root")
+	fs.IntVar(&opts.recurseMin, "recurse-min", 5, "Hosts a sub-zone needs before --depth scans it")
+	fs.BoolVar(&opts.exactRoot, "exact-root", false, "Scan roots as given instead of their registrable domain")
+	fs.StringVar(&opts.scopeFile, "scope", "", "Scope file applied to every root on top of ~/.nether/scopes/<root>.scope")
+	tlsPorts := fs.String("tls-ports", "443", "Comma-separated ports the tls source connects to")
+
+	fs.Parse(args)
+	if root == "" && fs.NArg() > 0 {
+		root = fs.Arg(0)
+	}
+
+	if !output.Valid(opts.output) {
+		fmt.Fprintf(os.Stderr, "Error: unknown output format %q\n", opts.output)
+		os.Exit(1)
+	}
+
+	ports, err := parsePorts(*tlsPorts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid --tls-ports: %v\n", err)
+		os.Exit(1)
+	}
+	opts.tlsPorts = ports
+	opts.dns = dns.NewClient(splitList(opts.resolvers), opts.qps)
+
+	// Wider ranges would take hours to sweep
+	if opts.ptrPrefix < 16 || opts.ptrPrefix > 32 {
+		fmt.Fprintf(os.Stderr, "Error: --ptr-prefix must be between 16 and 32\n")
+		os.Exit(1)
+	}
+	if opts.ptrPrefix6 < 112 || opts.ptrPrefix6 > 128 {
+		fmt.Fprintf(os.Stderr, "Error: --ptr-prefix6 must be between 112 and 128\n")
+		os.Exit(1)
+	}
+
+	// Validate the source list once rather than failing on every root
+	if _, err := scan.Lookup(opts.sourceNames(), opts.scanOptions()); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	// Create cache and decentralized network
+	c := cache.MustNew()
+	setScopeFile(c, opts.scopeFile)
+	network := p2p.NewNetworkDB(c)
+
+	if opts.list != "" {
+		roots, err := readRoots(opts.list)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if root != "" {
+			roots = append([]string{root}, roots...)
+		}
+		roots = opts.registrableRoots(roots)
+		if len(roots) == 0 {
+			fmt.Fprintf(os.Stderr, "Error: no roots found in %s\n", opts.list)
+			os.Exit(1)
+		}
+		if !cmdSubBatch(ctx, roots, opts, c, network, startTime) {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if root == "" {
+		fmt.Fprintf(os.Stderr, "Error: missing root domain\n")
+		usage()
+	}
+	root, err = registrableRoot(root, opts.exactRoot, opts.quiet)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	var printMu sync.Mutex
+	res := enumerate(ctx, root, opts, c, network, &printMu)
+	if res.err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", res.err)
+		os.Exit(1)
+	}
+
+	// Output phase, skipping hosts that were already streamed during the scan
+	if err := output.Write(os.Stdout, opts.outputOptions(), res.unprinted()); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Footer
+	elapsed := time.Since(startTime)
+	if !opts.quiet && len(res.rows) > 0 {
+		fmt.Fprintf(os.Stderr, "\nTotal: %d subdomains for %s\n", len(res.rows), root)
+		if len(res.added) > 0 {
+			fmt.Fprintf(os.Stderr, "New this run: %d\n", len(res.added))
+		}
+		fmt.Fprintf(os.Stderr, "Elapsed time: %v\n", elapsed.Round(time.Millisecond))
+	}
+}
+
+// cmdSubBatch enumerates roots with a bounded worker pool, printing per-root
+// progress and a combined summary. It returns false if any root failed.
+func cmdSubBatch(ctx context.Context, roots []string, opts *subOptions, c *cache.Cache, network *p2p.NetworkDB, startTime time.Time) bool {
+	workers := opts.concurrency
+	if workers <= 0 {
+		workers = 1
+	}
+	if !opts.quiet {
+		fmt.Fprintf(os.Stderr, "Batch mode: %d roots, %d concurrent\n", len(roots), workers)
+	}
+
+	jobs := make(chan string)
+	results := make(chan subResult)
+	var (
+		printMu sync.Mutex
+		wg      sync.WaitGroup
+	)
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for root := range jobs {
+				results <- enumerate(ctx, root, opts, c, network, &printMu)
+			}
+		}()
+	}
+
+	go func() {
+	feed:
+		for _, root := range roots {
+			select {
+			case jobs <- root:
+			case <-ctx.Done():
+				break feed
+			}
+		}
+		close(jobs)
+		wg.Wait()
+		close(results)
+	}()
+
+	var (
+		all      []cache.Tagged
+		done     int
+		total    int
+		added    int
+		failures []subResult
+	)
+	for res := range results {
+		done++
+		if res.err != nil {
+			failures = append(failures, res)
+			if !opts.quiet {
+				fmt.Fprintf(os.Stderr, "[%d/%d] %s: failed: %v\n", done, len(roots), res.root, res.err)
+			}
+			continue
+		}
+
+		total += len(res.rows)
+		added += len(res.added)
+		if !opts.quiet {
+			fmt.Fprintf(os.Stderr, "[%d/%d] %s: %d subdomains (%s, %d new)\n", done, len(roots), res.root, len(res.rows), res.origin, len(res.added))
+		}
+
+		if output.Streamable(opts.output) {
+			printMu.Lock()
+			err := output.Write(os.Stdout, opts.outputOptions(), res.unprinted())
+			printMu.Unlock()
+			if err != nil {
+				// Stdout is gone, so the remaining roots have nowhere to go
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				return false
+			}
+		} else {
+			all = append(all, res.unprinted()...)
+		}
+	}
+
+	if !output.Streamable(opts.output) {
+		if err := output.Write(os.Stdout, opts.outputOptions(), all); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return false
+		}
+	}
+
+	// Combined summary
+	if !opts.quiet {
+		fmt.Fprintf(os.Stderr, "\nBatch complete: %d/%d roots, %d subdomains, %d new\n", done-len(failures), len(roots), total, added)
+		if skipped := len(roots) - done; skipped > 0 {
+			fmt.Fprintf(os.Stderr, "Skipped: %d roots (interrupted)\n", skipped)
+		}
+		for _, res := range failures {
+			fmt.Fprintf(os.Stderr, "Failed: %s: %v\n", res.root, res.err)
+		}
+		fmt.Fprintf(os.Stderr, "Elapsed time: %v\n", time.Since(startTime).Round(time.Millisecond))
+	}
+
+	return len(failures) == 0
+}
+
+// enumerate runs the network -> cache -> scan strategy for one root and
+// returns its filtered rows. Streamed text output is serialized by printMu.
+func enumerate(ctx context.Context, root string, opts *subOptions, c *cache.Cache, network *p2p.NetworkDB, printMu *sync.Mutex) subResult {
+	res := subResult{root: root, printed: make(map[string]bool)}
+
+	sc, err := scope.ForRoot(c, root)
+	if err != nil {
+		res.err = err
+		return res
+	}
+
+	existing, err := c.List(root)
+	hasCache := err == nil && len(existing) > 0
+
+	// Strategy 1: Try decentralized network first (if enabled) when nothing is
+	// cached locally. Cached rows carry statuses the network doesn't know of.
+	// Network rows carry no records or probes, so skip them when rows need those.
+	// QueryDomain caches what it finds, and the rows are read back from there.
+	fromNetwork := false
+	if !hasCache && opts.networkMode && !opts.forceRescan && !opts.activeScan() && !opts.postProcessed() {
+		if subs, err := network.QueryDomain(root); err == nil && len(subs) > 0 {
+			if !opts.quiet && opts.list == "" {
+				fmt.Fprintf(os.Stderr, "Found %d subdomains in decentralized network for %s\n", len(subs), root)
+			}
+			fromNetwork = true
+		}
+	}
+
+	if fromNetwork {
+		res.origin = "network"
+	} else if hasCache && !opts.forceRescan && !opts.activeScan() {
+		// Strategy 2: Check local cache
+		// Use cached data for instant results
+		res.origin = "cache"
+		if !opts.quiet && opts.list == "" {
+			fmt.Fprintf(os.Stderr, "Found %d cached subdomains for %s (use --rescan for fresh scan)\n", len(existing), root)
+		}
+	} else {
+		// Strategy 3: No cache or forced rescan - run the selected sources
+		res.origin = "scan"
+		if err := scanRoot(ctx, root, opts, c, network, hasCache, printMu, &res); err != nil {
+			res.err = err
+			return res
+		}
+	}
+
+	if opts.resolve {
+		n, err := resolve.Root(ctx, c, root, opts.dns, opts.workers)
+		if err != nil && !interrupted(err) {
+			res.err = err
+			return res
+		}
+		if !opts.quiet && opts.list == "" {
+			fmt.Fprintf(os.Stderr, "Resolved %d hosts for %s\n", n, root)
+		}
+	}
+
+	rows, err := c.Rows(root)
+	if err != nil {
+		res.err = err
+		return res
+	}
+
+	filter := splitList(opts.sourceFilter)
+	kept := rows[:0]
+	for _, row := range rows {
+		if !opts.includeStale && row.State() != cache.StatusActive {
+			continue
+		}
+		if opts.alive && !row.Alive() {
+			continue
+		}
+		if opts.probed && len(row.HTTP) == 0 {
+			continue
+		}
+		if len(filter) > 0 && !merge.MatchSources(row, filter) {
+			continue
+		}
+		if !sc.AllowsRow(row) {
+			continue
+		}
+		kept = append(kept, row)
+	}
+	res.rows = kept
+
+	return res
+}
+
+// scanRoot runs the selected sources against root, streaming and caching
+// results, then publishes the updated cache to the network.
+func scanRoot(ctx context.Context, root string, opts *subOptions, c *cache.Cache, network *p2p.NetworkDB, hasCache bool, printMu *sync.Mutex, res *subResult) error {
+	// Native scanners never contact hosts or ranges outside the root's scope
+	sc, err := scope.ForRoot(c, root)
+	if err != nil {
+		return err
+	}
+	scanOpts := opts.scanOptions()
+	scanOpts.Scope = sc
+	scanners, err := scan.Lookup(opts.sourceNames(), scanOpts)
+	if err != nil {
+		return err
+	}
+
+	if !opts.quiet {
+		var using []string
+		for _, s := range scanners {
+			using = append(using, s.Name())
+		}
+		if hasCache {
+			fmt.Fprintf(os.Stderr, "Rescanning %s with %s...\n", root, strings.Join(using, ", "))
+		} else {
+			fmt.Fprintf(os.Stderr, "No cache found, scanning %s with %s...\n", root, strings.Join(using, ", "))
+		}
+	}
+
+	stream := newScanStream(root, c, nil)
+	stream.quiet = opts.quiet || opts.list != ""
+	if opts.wildcardFilter {
+		stream.detector = dns.NewWildcardDetector(opts.dns)
+	}
+	// Stream text and jsonl output as results arrive unless rows are filtered
+	// or enriched after the scan. Once stdout fails the scan is stopped, as
+	// its results have nowhere to go; what was found is still cached.
+	ctx, stop := context.WithCancel(ctx)
+	defer stop()
+	var writeErr error
+	if output.Streamable(opts.output) && !opts.postProcessed() {
+		stream.onRow = func(row cache.Row) {
+			if writeErr != nil {
+				return
+			}
+			printMu.Lock()
+			err := output.WriteRow(os.Stdout, opts.outputOptions(), cache.Tagged{Root: root, Row: row})
+			printMu.Unlock()
+			if err != nil {
+				writeErr = fmt.Errorf("failed to write results: %w", err)
+				stop()
+				return
+			}
+			res.printed[row.Sub] = true
+		}
+	}
+
+	if opts.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.timeout)
+		defer cancel()
+	}
+	errs, err := runPhases(ctx, stream, c, scanners)
+	if writeErr != nil {
+		return writeErr
+	}
+	if err != nil {
+		return err
+	}
+	zoneErrs, err := recurseZones(ctx, stream, c, scanners, opts)
+	if err != nil {
+		return err
+	}
+	stream.recordWildcards()
+	res.added = stream.added
+
+	failed := 0
+	for name, err := range errs {
+		if errors.Is(err, scan.ErrNoTransfer) {
+			continue // Expected of most zones; sweep still skips the source
+		}
+		if interrupted(err) {
+			fmt.Fprintf(os.Stderr, "Warning: %s: %s stopped early (%v), keeping partial results\n", root, name, err)
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "Warning: %s: %s: %v\n", root, name, err)
+		failed++
+	}
+	if failed == len(scanners) {
+		return errors.New("all sources failed")
+	}
+
+	// A source that failed on any sub-zone must not age the hosts it missed
+	for name, err := range zoneErrs {
+		if errs[name] == nil {
+			errs[name] = err
+		}
+	}
+	swept, err := stream.sweep(errs)
+	if err != nil {
+		return err
+	}
+
+	if !opts.quiet && opts.list == "" {
+		if stream.dropped > 0 {
+			fmt.Fprintf(os.Stderr, "Filtered %d wildcard matches\n", stream.dropped)
+		}
+		if summary := stream.invalidSummary(); summary != "" {
+			fmt.Fprintf(os.Stderr, "Dropped %s\n", summary)
+		}
+		for _, row := range res.added {
+			for _, f := range row.Findings {
+				if f.Kind == merge.KindHomograph {
+					fmt.Fprintf(os.Stderr, "Warning: %s looks like a homograph: %s\n", util.ToUnicode(row.Sub), f.Evidence)
+				}
+			}
+		}
+		if len(swept.Stale) > 0 || len(swept.Removed) > 0 {
+			fmt.Fprintf(os.Stderr, "Missing from this scan: %d now stale, %d removed (see --include-stale)\n", len(swept.Stale), len(swept.Removed))
+		}
+		if hasCache {
+			fmt.Fprintf(os.Stderr, "Found %d subdomains, added %d new\n", stream.found, len(res.added))
+		} else {
+			fmt.Fprintf(os.Stderr, "Cached %d subdomains\n", stream.found)
+		}
+	}
+
+	// Publish to decentralized network if we scanned new data
+	if opts.networkMode && opts.publishMode && (len(res.added) > 0 || !hasCache) {
+		if !opts.quiet {
+			fmt.Fprintf(os.Stderr, "Publishing %s to decentralized network...\n", root)
+		}
+
+		// Publish the cached rows for this domain, including their sources
+		rows, err := c.Rows(root)
+		if err == nil && len(rows) > 0 {
+			if hash, err := network.PublishDomain(root, rows); err == nil {
+				if !opts.quiet {
+					fmt.Fprintf(os.Stderr, "Published to network: %s\n", hash)
+				}
+			} else if !opts.quiet {
+				fmt.Fprintf(os.Stderr, "Warning: failed to publish to network: %v\n", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// runPhases runs the scanners through stream. Seeded scanners run once the
+// others are done, starting from every live host cached under the scanned
+// domain.
+func runPhases(ctx context.Context, stream *scanStream, c *cache.Cache, scanners []scan.Scanner) (map[string]error, error) {
+	var first, seeded []scan.Scanner
+	for _, s := range scanners {
+		if _, ok := s.(scan.Seeded); ok {
+			seeded = append(seeded, s)
+		} else {
+			first = append(first, s)
+		}
+	}
+
+	errs := make(map[string]error)
+	if len(first) > 0 {
+		phaseErrs, err := stream.run(ctx, first)
+		if err != nil {
+			return nil, err
+		}
+		for name, err := range phaseErrs {
+			errs[name] = err
+		}
+	}
+	if len(seeded) == 0 {
+		return errs, nil
+	}
+
+	rows, err := c.Rows(stream.root)
+	if err != nil {
+		return nil, err
+	}
+	target := stream.target()
+	var hosts []string
+	for _, row := range rows {
+		if row.Sub != target && !strings.HasSuffix(row.Sub, "."+target) {
+			continue
+		}
+		if row.State() != cache.StatusRemoved && (row.DNS == nil || row.Alive()) {
+			hosts = append(hosts, row.Sub)
+		}
+	}
+	for _, s := range seeded {
+		s.(scan.Seeded).Seed(hosts)
+	}
+
+	phaseErrs, err := stream.run(ctx, seeded)
+	if err != nil {
+		return nil, err
+	}
+	for name, err := range phaseErrs {
+		errs[name] = err
+	}
+	return errs, nil
+}
+
+// activeScan reports whether DNS-based sources were requested explicitly,
+// which runs a scan even when results are cached.
+func (o *subOptions) activeScan() bool {
+	return o.brute || o.permute || o.ptrSweep
+}
+
+// recurseZones scans the dense sub-zones of the stream's root as roots of
+// their own, one level deeper at a time up to --depth, merging the results
+// under the root with the sub-zone recorded as their parent. Failures are
+// reported as warnings and returned per source.
+func recurseZones(ctx context.Context, stream *scanStream, c *cache.Cache, scanners []scan.Scanner, opts *subOptions) (map[string]error, error) {
+	defer func() { stream.zone = "" }()
+
+	errs := make(map[string]error)
+	scanned := make(map[string]bool)
+	for level := 1; level <= opts.depth && ctx.Err() == nil; level++ {
+		rows, err := c.Rows(stream.root)
+		if err != nil {
+			return nil, err
+		}
+		var hosts []string
+		for _, row := range rows {
+			if row.State() == cache.StatusActive {
+				hosts = append(hosts, row.Sub)
+			}
+		}
+
+		for _, zone := range scan.DenseZones(stream.root, hosts, level, opts.recurseMin) {
+			if scanned[zone] || ctx.Err() != nil {
+				continue
+			}
+			scanned[zone] = true
+			if !opts.quiet {
+				fmt.Fprintf(os.Stderr, "Recursing into %s (depth %d)...\n", zone, level)
+			}
+
+			stream.zone = zone
+			phaseErrs, err := runPhases(ctx, stream, c, scanners)
+			if err != nil {
+				return nil, err
+			}
+			for name, err := range phaseErrs {
+				if !interrupted(err) && !errors.Is(err, scan.ErrNoTransfer) {
+					fmt.Fprintf(os.Stderr, "Warning: %s: %s: %v\n", zone, name, err)
+				}
+				errs[name] = err
+			}
+		}
+	}
+	return errs, nil
+}
+
+// sourceNames returns the scanners selected by --sources, --brute, --permute
+// and --ptr-sweep.
+func (o *subOptions) sourceNames() []string {
+	names := splitList(o.sources)
+	if o.brute {
+		names = append(names, "brute")
+	}
+	if o.permute {
+		names = append(names, "permute")
+	}
+	if o.ptrSweep {
+		names = append(names, "ptr")
+	}
+	return names
+}
+
+// scanOptions returns the shared scanner settings.
+func (o *subOptions) scanOptions() scan.Options {
+	return scan.Options{
+		Wordlist:  o.wordlist,
+		Resolvers: splitList(o.resolvers),
+		Workers:   o.workers,
+		QPS:       o.qps,
+		TLSPorts:  o.tlsPorts,
+		DNS:       o.dns,
+
+		PTRPrefix:  o.ptrPrefix,
+		PTRPrefix6: o.ptrPrefix6,
+	}
+}
+
+// postProcessed reports whether rows are filtered or enriched after the scan,
+// which rules out streaming them as they are found.
+func (o *subOptions) postProcessed() bool {
+	return o.sourceFilter != "" || o.resolve || o.alive || o.probed
+}
+
+// outputOptions returns the rendering settings selected by -o, --full,
+// --probed and --unicode.
+func (o *subOptions) outputOptions() output.Options {
+	return output.Options{Format: o.output, Full: o.full, Probed: o.probed, Unicode: o.unicode}
+}
+
+// unprinted returns the result rows tagged with their root, leaving out
+// hosts that were already streamed to stdout.
+func (r *subResult) unprinted() []cache.Tagged {
+	tagged := make([]cache.Tagged, 0, len(r.rows))
+	for _, row := range r.rows {
+		if !r.printed[row.Sub] {
+			tagged = append(tagged, cache.Tagged{Root: r.root, Row: row})
+		}
+	}
+	return tagged
+}
+
+// registrableRoot normalizes a root given on the command line and moves it
+// up to its registrable domain, so www.example.com and api.example.com are
+// both scanned and cached as example.com. With exact the root is kept as
+// given and only a warning is printed. Every command taking a root goes
+// through it so it finds the hosts where sub cached them.
+func registrableRoot(root string, exact, quiet bool) (string, error) {
+	host := util.NormalizeHost(root)
+	if host == "" {
+		return "", fmt.Errorf("invalid root domain %q", root)
+	}
+
+	domain, err := util.Registrable(host)
+	switch {
+	case err != nil && exact:
+		fmt.Fprintf(os.Stderr, "Warning: %v, using it anyway\n", err)
+		return host, nil
+	case err != nil:
+		return "", fmt.Errorf("%v (use --exact-root to use it anyway)", err)
+	case domain == host:
+		return host, nil
+	case exact:
+		if !quiet {
+			fmt.Fprintf(os.Stderr, "Warning: %s is not a registrable domain, its hosts are cached apart from %s\n", host, domain)
+		}
+		return host, nil
+	}
+
+	if !quiet {
+		fmt.Fprintf(os.Stderr, "%s is not a registrable domain, using %s instead (use --exact-root to keep it)\n", host, domain)
+	}
+	return domain, nil
+}
+
+// registrableRoots applies registrableRoot to a batch of roots, merging roots
+// that share a registrable domain and skipping those that can't be scanned.
+func (o *subOptions) registrableRoots(roots []string) []string {
+	seen := make(map[string]bool)
+	var out []string
+	for _, root := range roots {
+		domain, err := registrableRoot(root, o.exactRoot, o.quiet)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: skipping %s: %v\n", root, err)
+			continue
+		}
+		if !seen[domain] {
+			seen[domain] = true
+			out = append(out, domain)
+		}
+	}
+	return out
+}
+
+// readRoots reads one root domain per line from path, or stdin for "-".
+// Blank lines and #-comments are skipped and duplicates removed.
+func readRoots(path string) ([]string, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open roots file: %w", err)
+		}
+		defer file.Close()
+		r = file
+	}
+
+	seen := make(map[string]bool)
+	var roots []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		root := util.NormalizeHost(line)
+		if root == "" || seen[root] {
+			continue
+		}
+		seen[root] = true
+		roots = append(roots, root)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read roots: %w", err)
+	}
+
+	return roots, nil
+}
+
+// setScopeFile sets the project scope file on c, exiting if it can't be read
+// so a typo never lets a scan run unscoped.
+func setScopeFile(c *cache.Cache, path string) {
+	if path == "" {
+		return
+	}
+	if _, err := scope.Load(path); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	c.ScopeFile = path
+}
+
+// scopeFor returns the scope of root, exiting if a scope file can't be read.
+func scopeFor(c *cache.Cache, root string) *scope.Scope {
+	sc, err := scope.ForRoot(c, root)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	return sc
+}
+
+// parsePorts parses a comma-separated list of TCP ports.
+func parsePorts(s string) ([]int, error) {
+	var ports []int
+	for _, part := range splitList(s) {
+		port, err := strconv.Atoi(part)
+		if err != nil || port <= 0 || port > 65535 {
+			return nil, fmt.Errorf("invalid port %q", part)
+		}
+		ports = append(ports, port)
+	}
+	return ports, nil
+}
+
+// splitList splits a comma-separated flag value, dropping empty entries.
+func splitList(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/amoz0x/nether/internal/cache"
+	"github.com/amoz0x/nether/internal/dns"
+	"github.com/amoz0x/nether/internal/merge"
+	"github.com/amoz0x/nether/internal/resolve"
+	"github.com/amoz0x/nether/internal/takeover"
+)
+
+// takeoverJSON is the JSON output form of a takeover finding.
+type takeoverJSON struct {
+	Root string `json:"root"`
+	Sub  string `json:"sub"`
+	cache.Finding
+}
+
+// cmdTakeover checks the cached hosts of a root for dangling CNAMEs to
+// third-party services and stores the findings in the cache.
+func cmdTakeover(args []string) {
+	startTime := time.Now()
+
+	var root string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		root = args[0]
+		args = args[1:]
+	}
+
+	fs := flag.NewFlagSet("takeover", flag.ExitOnError)
+	output := fs.String("o", "text", "Output format (text|json)")
+	fpPath := fs.String("fingerprints", "", "Fingerprint file (default: ~/.nether/fingerprints.json, else bundled)")
+	dump := fs.Bool("dump-fingerprints", false, "Print the bundled fingerprint file and exit")
+	doResolve := fs.Bool("resolve", true, "Resolve hosts before checking them")
+	resolvers := fs.String("resolvers", "", "Comma-separated DNS resolvers")
+	workers := fs.Int("workers", 50, "Concurrent DNS lookups")
+	qps := fs.Int("qps", 200, "Max DNS queries per second (0 for unlimited)")
+	httpTimeout := fs.Duration("http-timeout", 10*time.Second, "Timeout for fetching fingerprinted pages")
+	scopeFile := fs.String("scope", "", "Scope file applied on top of ~/.nether/scopes/<root>.scope")
+	exactRoot := fs.Bool("exact-root", false, "Use the root as given instead of its registrable domain")
+	quiet := fs.Bool("q", false, "Quiet mode")
+	fs.Parse(args)
+	if root == "" && fs.NArg() > 0 {
+		root = fs.Arg(0)
+	}
+
+	if *dump {
+		os.Stdout.Write(takeover.DefaultFingerprints())
+		return
+	}
+
+	if root == "" {
+		fmt.Fprintf(os.Stderr, "Error: missing root domain\n")
+		usage()
+	}
+	root, err := registrableRoot(root, *exactRoot, *quiet)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if *output != "text" && *output != "json" {
+		fmt.Fprintf(os.Stderr, "Error: unknown output format %q\n", *output)
+		os.Exit(1)
+	}
+
+	c := cache.MustNew()
+	setScopeFile(c, *scopeFile)
+
+	// A fingerprint file in the nether directory overrides the bundled one
+	if *fpPath == "" {
+		if p := filepath.Join(c.Base, "fingerprints.json"); fileExists(p) {
+			*fpPath = p
+		}
+	}
+	fps, err := takeover.LoadFingerprints(*fpPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if subs, err := c.List(root); err != nil || len(subs) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: no cached subdomains for %s (run: blink sub %s)\n", root, root)
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if *doResolve {
+		client := dns.NewClient(splitList(*resolvers), *qps)
+		if _, err := resolve.Root(ctx, c, root, client, *workers); err != nil && !interrupted(err) {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	rows, err := c.Rows(root)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	sc := scopeFor(c, root)
+	var candidates []cache.Row
+	for _, row := range rows {
+		if row.State() != cache.StatusRemoved && sc.AllowsRow(row) {
+			candidates = append(candidates, row)
+		}
+	}
+
+	checker := takeover.NewChecker(fps)
+	checker.Fetch = takeover.HTTPFetcher(*httpTimeout, sc)
+	checked, findings := checker.CheckAll(ctx, candidates)
+	if err := merge.SetFindings(root, takeover.Kind, checked, findings, c); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	var results []takeoverJSON
+	for sub, list := range findings {
+		for _, f := range list {
+			results = append(results, takeoverJSON{Root: root, Sub: sub, Finding: f})
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Sub < results[j].Sub
+	})
+
+	if *output == "json" {
+		if results == nil {
+			results = []takeoverJSON{}
+		}
+		data, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: failed to marshal JSON: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(data))
+	} else {
+		for _, r := range results {
+			fmt.Printf("%s -> %s [%s] %s\n", r.Sub, r.Target, r.Service, r.Evidence)
+		}
+	}
+
+	if !*quiet {
+		fmt.Fprintf(os.Stderr, "\nChecked %d hosts for %s, %d possible takeovers\n", len(checked), root, len(results))
+		if len(checked) < len(candidates) {
+			fmt.Fprintf(os.Stderr, "Skipped %d hosts without DNS records\n", len(candidates)-len(checked))
+		}
+		fmt.Fprintf(os.Stderr, "Elapsed time: %v\n", time.Since(startTime).Round(time.Millisecond))
+	}
+}
+
+// fileExists reports whether path names an existing regular file.
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular()
+}
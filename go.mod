@@ -2,4 +2,9 @@ module github.com/amoz0x/nether
 
 go 1.21
 
-require github.com/klauspost/compress v1.17.9
+require (
+	github.com/klauspost/compress v1.17.9
+	golang.org/x/net v0.20.0
+)
+
+require golang.org/x/text v0.14.0 // indirect
@@ -2,9 +2,9 @@
 package cache
 
 import (
-	"bufio"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"sort"
@@ -16,15 +16,76 @@ import (
 
 // Row represents a subdomain entry in the cache.
 type Row struct {
-	Sub       string `json:"sub"`
-	FirstSeen string `json:"first_seen"`
-	LastSeen  string `json:"last_seen"`
-	SrcBits   int    `json:"src_bits"`
+	Sub       string    `json:"sub"`
+	FirstSeen string    `json:"first_seen"`
+	LastSeen  string    `json:"last_seen"`
+	SrcBits   int       `json:"src_bits"`
+	Sources   []string  `json:"sources,omitempty"`  // Upstream sources, e.g. crtsh or virustotal
+	Status    string    `json:"status,omitempty"`   // Empty while active, see State
+	Misses    int       `json:"misses,omitempty"`   // Consecutive completed scans that missed the host
+	Parent    string    `json:"parent,omitempty"`   // Sub-zone scanned as a root of its own that found the host
+	DNS       *Records  `json:"dns,omitempty"`      // Set once the host has been resolved
+	Findings  []Finding `json:"findings,omitempty"` // Issues reported by checks such as takeover
+	HTTP      []Probe   `json:"http,omitempty"`     // Responses from the last probe, one per answering URL
+}
+
+// Probe is the response of a host to an HTTP(S) request.
+type Probe struct {
+	URL           string   `json:"url"`
+	Status        int      `json:"status"`
+	FinalURL      string   `json:"final_url,omitempty"` // After redirects, when different from URL
+	Title         string   `json:"title,omitempty"`
+	ContentLength int64    `json:"content_length"`
+	Server        string   `json:"server,omitempty"`
+	Tech          []string `json:"tech,omitempty"`        // e.g. X-Powered-By and generator hints
+	TLSSubject    string   `json:"tls_subject,omitempty"` // Leaf certificate subject for HTTPS
+	ProbedAt      string   `json:"probed_at"`
+}
+
+// Finding is an issue detected on a host.
+type Finding struct {
+	Kind       string `json:"kind"` // Check that produced it, e.g. takeover
+	Service    string `json:"service,omitempty"`
+	Target     string `json:"target,omitempty"`
+	Evidence   string `json:"evidence"`
+	DetectedAt string `json:"detected_at"`
+}
+
+// Records holds the DNS answers of the last resolution of a row.
+type Records struct {
+	A          []string `json:"a,omitempty"`
+	AAAA       []string `json:"aaaa,omitempty"`
+	CNAME      []string `json:"cname,omitempty"` // Chain in resolution order
+	NXDomain   bool     `json:"nxdomain,omitempty"`
+	ResolvedAt string   `json:"resolved_at"`
+}
+
+// Alive reports whether the row resolved to at least one address when it
+// was last resolved.
+func (r Row) Alive() bool {
+	return r.DNS != nil && len(r.DNS.A)+len(r.DNS.AAAA) > 0
+}
+
+// Row statuses.
+const (
+	StatusActive  = "active"
+	StatusStale   = "stale"
+	StatusRemoved = "removed"
+)
+
+// State returns the row's status, treating an unset status as active.
+func (r Row) State() string {
+	if r.Status == "" {
+		return StatusActive
+	}
+	return r.Status
 }
 
 // Cache manages subdomain cache storage.
 type Cache struct {
-	Base string // Base directory, typically ~/.blink
+	Base        string        // Base directory, typically ~/.blink
+	ScopeFile   string        // Project scope applied to every root on top of per-root scope files; may be empty
+	LockTimeout time.Duration // How long to wait for a root locked by another process; zero uses DefaultLockTimeout
 }
 
 // MustNew creates a new cache instance, ensuring directories exist.
@@ -52,146 +113,159 @@ func (c *Cache) CachePath(root string) string {
 	return filepath.Join(c.Base, "cache", root+".jsonl.zst")
 }
 
+// ScopePath returns the path to the scope file for a given root domain.
+func (c *Cache) ScopePath(root string) string {
+	return filepath.Join(c.Base, "scopes", root+".scope")
+}
+
 // DeltaPath returns the path to a delta file for a given root domain and timestamp.
 func (c *Cache) DeltaPath(root string, ts time.Time) string {
-	filename := fmt.Sprintf("%s.delta-%s.jsonl.zst", root, ts.Format("20060102T150405"))
+	filename := fmt.Sprintf("%s.delta-%s.jsonl.zst", root, ts.Format(deltaTimeLayout))
 	return filepath.Join(c.Base, "deltas", filename)
 }
 
-// IterRows iterates over all rows in the cache file for a given root domain.
+// IterRows calls fn for every row of root in subdomain order. Rows are read
+// from the shard and then the log, and the last version written for a host
+// is the one seen. The root is read under a shared lock, so the rows are
+// never those of a write in progress.
 func (c *Cache) IterRows(root string, fn func(Row)) error {
-	path := c.CachePath(root)
-	
-	// If file doesn't exist, that's fine - just return
-	if _, err := os.Stat(path); os.IsNotExist(err) {
-		return nil
+	rows, err := c.Rows(root)
+	if err != nil {
+		return err
 	}
 	
-	reader, err := util.OpenZst(path)
+	for _, row := range rows {
+		fn(row)
+	}
+	return nil
+}
+
+// WriteRows replaces the content of the cache for root with rows. Later
+// rows win over earlier ones for the same subdomain. Merges record their
+// changes with AppendRows and DeleteRows instead.
+func (c *Cache) WriteRows(root string, rows []Row) error {
+	l, err := c.Lock(root)
 	if err != nil {
-		return fmt.Errorf("failed to open cache file: %w", err)
+		return err
 	}
-	defer reader.Close()
+	defer l.Unlock()
 	
-	scanner := bufio.NewScanner(reader)
-	for scanner.Scan() {
-		line := scanner.Text()
-		if line == "" {
-			continue // Skip blank lines
-		}
-		
-		var row Row
-		if err := json.Unmarshal([]byte(line), &row); err != nil {
-			// Log warning but continue
-			fmt.Fprintf(os.Stderr, "Warning: invalid JSON in cache: %s\n", line)
-			continue
-		}
-		
-		fn(row)
+	// The log would be replayed over the new content
+	if err := l.removeLog(); err != nil {
+		return err
 	}
+	return c.writeShard(root, rows)
+}
+
+// ImportShard replaces the content of the cache for root with a shard read
+// from r, such as one fetched from the network.
+func (c *Cache) ImportShard(root string, r io.Reader) error {
+	l, err := c.Lock(root)
+	if err != nil {
+		return err
+	}
+	defer l.Unlock()
 	
-	return scanner.Err()
+	if err := l.removeLog(); err != nil {
+		return err
+	}
+	err = util.WriteAtomic(c.CachePath(root), func(w io.Writer) error {
+		_, err := io.Copy(w, r)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write cache file: %w", err)
+	}
+	return nil
 }
 
-// WriteRows writes rows to the cache file, replacing any existing content.
-func (c *Cache) WriteRows(root string, rows []Row) error {
+// writeShard replaces the shard of root with rows sorted by subdomain,
+// keeping the last row given for each subdomain.
+func (c *Cache) writeShard(root string, rows []Row) error {
 	// Sort rows by subdomain
-	sort.Slice(rows, func(i, j int) bool {
+	sort.SliceStable(rows, func(i, j int) bool {
 		return rows[i].Sub < rows[j].Sub
 	})
 	
-	path := c.CachePath(root)
-	writer, err := util.CreateZst(path)
-	if err != nil {
-		return fmt.Errorf("failed to create cache file: %w", err)
+	// Duplicates are adjacent and in their original order after the sort
+	kept := make([]Row, 0, len(rows))
+	for i, row := range rows {
+		if i+1 < len(rows) && rows[i+1].Sub == row.Sub {
+			continue
+		}
+		kept = append(kept, row)
 	}
-	defer writer.Close()
 	
-	for _, row := range rows {
-		data, err := json.Marshal(row)
+	err := util.WriteZstAtomic(c.CachePath(root), func(w io.Writer) error {
+		return writeJSONL(w, kept)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write cache file: %w", err)
+	}
+	return nil
+}
+
+// writeJSONL writes each of values to w as a line of JSON.
+func writeJSONL[T any](w io.Writer, values []T) error {
+	for _, v := range values {
+		data, err := json.Marshal(v)
 		if err != nil {
 			return fmt.Errorf("failed to marshal row: %w", err)
 		}
 		
-		if _, err := fmt.Fprintln(writer, string(data)); err != nil {
+		if _, err := fmt.Fprintln(w, string(data)); err != nil {
 			return fmt.Errorf("failed to write row: %w", err)
 		}
 	}
-	
 	return nil
 }
 
 // List returns a sorted list of unique subdomains from the cache.
 func (c *Cache) List(root string) ([]string, error) {
-	seen := make(map[string]bool)
-	
+	var subs []string
 	err := c.IterRows(root, func(row Row) {
-		seen[row.Sub] = true
+		subs = append(subs, row.Sub)
 	})
 	if err != nil {
 		return nil, err
 	}
-	
-	var subs []string
-	for sub := range seen {
-		subs = append(subs, sub)
-	}
-	
-	sort.Strings(subs)
 	return subs, nil
 }
 
-// AppendDelta writes new rows to a delta file and returns the file path.
-func (c *Cache) AppendDelta(root string, newRows []Row) (string, error) {
-	if len(newRows) == 0 {
-		return "", nil
+// Rows returns the rows for root sorted by subdomain, keeping the last row
+// written for each subdomain. Like IterRows it reads under a shared lock.
+func (c *Cache) Rows(root string) ([]Row, error) {
+	release, err := c.lock(root, false)
+	if err != nil {
+		return nil, err
 	}
+	defer release()
 	
-	ts := time.Now().UTC()
-	path := c.DeltaPath(root, ts)
-	
-	writer, err := util.CreateZst(path)
+	bySub, damaged, err := c.readRows(root, nil)
 	if err != nil {
-		return "", fmt.Errorf("failed to create delta file: %w", err)
+		return nil, err
 	}
-	defer writer.Close()
-	
-	for _, row := range newRows {
-		data, err := json.Marshal(row)
-		if err != nil {
-			return "", fmt.Errorf("failed to marshal row: %w", err)
-		}
-		
-		if _, err := fmt.Fprintln(writer, string(data)); err != nil {
-			return "", fmt.Errorf("failed to write row: %w", err)
-		}
+	if damaged {
+		fmt.Fprintf(os.Stderr, "Warning: ignoring the unreadable end of the cache log of %s\n", root)
 	}
-	
-	return path, nil
+	return sortedRows(bySub), nil
 }
 
-// PrintText prints subdomains in plain text format.
-func PrintText(subs []string) {
-	for _, sub := range subs {
-		fmt.Println(sub)
-	}
-}
-
-// PrintJSON prints subdomains in JSON array format.
-func PrintJSON(subs []string) {
-	data, err := json.MarshalIndent(subs, "", "  ")
+// AppendDelta writes new rows to a delta file and returns the file path.
+// Rows written within the same second are appended to the same file.
+func (c *Cache) AppendDelta(root string, newRows []Row) (string, error) {
+	l, err := c.Lock(root)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error marshaling JSON: %v\n", err)
-		return
+		return "", err
 	}
-	fmt.Println(string(data))
+	defer l.Unlock()
+	return l.AppendDelta(newRows)
 }
 
-// PrintCSV prints subdomains in CSV format.
-func PrintCSV(subs []string) {
-	for _, sub := range subs {
-		fmt.Println(sub)
-	}
+// Tagged is a row labelled with the root domain it belongs to.
+type Tagged struct {
+	Root string
+	Row
 }
 
 // ListDomains returns a list of all domains that have cached data
@@ -202,12 +276,18 @@ func (c *Cache) ListDomains() []string {
 		return []string{}
 	}
 
+	// A root written only through the log has no shard yet
+	seen := make(map[string]bool)
 	var domains []string
 	for _, entry := range entries {
-		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".jsonl.zst") {
-			// Remove .jsonl.zst extension to get domain name
-			domain := strings.TrimSuffix(entry.Name(), ".jsonl.zst")
-			domains = append(domains, domain)
+		if entry.IsDir() {
+			continue
+		}
+		for _, suffix := range []string{".jsonl.zst", ".log.zst"} {
+			if domain, ok := strings.CutSuffix(entry.Name(), suffix); ok && !seen[domain] {
+				seen[domain] = true
+				domains = append(domains, domain)
+			}
 		}
 	}
 
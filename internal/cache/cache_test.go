@@ -4,6 +4,7 @@ package cache
 import (
 	"os"
 	"path/filepath"
+	"reflect"
 	"testing"
 	"time"
 )
@@ -92,8 +93,42 @@ func TestIterRowsNormalizesAndMerges(t *testing.T) {
 		t.Fatalf("Failed to iterate rows: %v", err)
 	}
 	
-	// Should have both entries (WriteRows doesn't merge, just sorts)
-	if len(collected) != 2 {
-		t.Fatalf("Expected 2 rows, got %d", len(collected))
+	// The last write of a subdomain wins
+	if len(collected) != 1 {
+		t.Fatalf("Expected 1 row, got %d", len(collected))
+	}
+	if collected[0].SrcBits != 2 {
+		t.Errorf("Expected the later duplicate to win, got src_bits %d", collected[0].SrcBits)
+	}
+}
+
+func TestWriteRowsDropsDuplicates(t *testing.T) {
+	c := newTestCache(t)
+	rows := []Row{
+		{Sub: "www.example.com", SrcBits: 1},
+		{Sub: "api.example.com", SrcBits: 1},
+		{Sub: "www.example.com", SrcBits: 2},
+		{Sub: "api.example.com", SrcBits: 4},
+		{Sub: "www.example.com", SrcBits: 8},
+	}
+	if err := c.WriteRows("example.com", rows); err != nil {
+		t.Fatalf("Failed to write rows: %v", err)
+	}
+
+	reports, err := c.Fsck("example.com", false)
+	if err != nil {
+		t.Fatalf("Failed to check cache: %v", err)
+	}
+	if len(reports) != 1 || reports[0].Rows != 2 || len(reports[0].Problems) != 0 {
+		t.Fatalf("Expected a shard of 2 rows without problems, got %+v", reports)
+	}
+
+	got, err := c.Rows("example.com")
+	if err != nil {
+		t.Fatalf("Failed to read rows: %v", err)
+	}
+	want := []Row{{Sub: "api.example.com", SrcBits: 4}, {Sub: "www.example.com", SrcBits: 8}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
 	}
 }
@@ -0,0 +1,151 @@
+package cache
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/amoz0x/nether/internal/util"
+)
+
+// deltaTimeLayout is the timestamp format embedded in delta file names.
+const deltaTimeLayout = "20060102T150405"
+
+// Delta is a delta file written by a merge that added rows.
+type Delta struct {
+	Path string
+	Time time.Time // UTC, truncated to the second
+}
+
+// Deltas returns the delta files for root, oldest first.
+func (c *Cache) Deltas(root string) ([]Delta, error) {
+	prefix := root + ".delta-"
+	matches, err := filepath.Glob(filepath.Join(c.Base, "deltas", prefix+"*.jsonl.zst"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list deltas: %w", err)
+	}
+
+	var deltas []Delta
+	for _, path := range matches {
+		stamp := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), prefix), ".jsonl.zst")
+		ts, err := time.Parse(deltaTimeLayout, stamp)
+		if err != nil {
+			continue // Not one of ours
+		}
+		deltas = append(deltas, Delta{Path: path, Time: ts})
+	}
+
+	sort.Slice(deltas, func(i, j int) bool {
+		return deltas[i].Time.Before(deltas[j].Time)
+	})
+	return deltas, nil
+}
+
+// ReadDelta returns the rows stored in a delta file.
+func (c *Cache) ReadDelta(path string) ([]Row, error) {
+	reader, err := util.OpenZst(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open delta file: %w", err)
+	}
+	defer reader.Close()
+
+	var rows []Row
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		var row Row
+		if err := json.Unmarshal(line, &row); err != nil {
+			return nil, fmt.Errorf("invalid JSON in %s: %w", filepath.Base(path), err)
+		}
+		rows = append(rows, row)
+	}
+
+	return rows, scanner.Err()
+}
+
+// Diff describes how the subdomains of a root changed between two points in time.
+type Diff struct {
+	Root    string
+	From    time.Time
+	To      time.Time
+	Added   []Row // First seen (or seen again) within the window, with current cache metadata
+	Removed []Row // Marked removed within the window and not added again since
+}
+
+// Diff reconstructs the hosts added to and removed from root between from
+// and to (inclusive) from the delta files. Added hosts are completed by cache
+// rows whose first_seen falls in the window in case a delta is missing. A host
+// with several changes in the window is reported by its latest one.
+func (c *Cache) Diff(root string, from, to time.Time) (*Diff, error) {
+	current, err := c.Rows(root)
+	if err != nil {
+		return nil, err
+	}
+	bySub := make(map[string]Row, len(current))
+	for _, row := range current {
+		bySub[row.Sub] = row
+	}
+
+	deltas, err := c.Deltas(root)
+	if err != nil {
+		return nil, err
+	}
+
+	latest := make(map[string]Row)
+	readded := make(map[string]bool) // Hosts added again after the window
+	for _, d := range deltas {
+		if d.Time.Before(from.Truncate(time.Second)) {
+			continue
+		}
+		rows, err := c.ReadDelta(d.Path)
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			if !d.Time.After(to) {
+				latest[row.Sub] = row
+			} else if row.Status != StatusRemoved {
+				readded[row.Sub] = true
+			}
+		}
+	}
+
+	for _, row := range current {
+		if _, ok := latest[row.Sub]; ok || row.Status == StatusRemoved {
+			continue
+		}
+		if seen, err := time.Parse(time.RFC3339, row.FirstSeen); err == nil && !seen.Before(from.Truncate(time.Second)) && !seen.After(to) {
+			latest[row.Sub] = row
+		}
+	}
+
+	diff := &Diff{Root: root, From: from, To: to}
+	for sub, row := range latest {
+		removed := row.Status == StatusRemoved
+		if cur, ok := bySub[sub]; ok {
+			row = cur
+		}
+		if removed && (readded[sub] || row.State() != StatusRemoved) {
+			continue // Seen again since
+		}
+		if removed {
+			diff.Removed = append(diff.Removed, row)
+		} else {
+			diff.Added = append(diff.Added, row)
+		}
+	}
+	for _, rows := range [][]Row{diff.Added, diff.Removed} {
+		sort.Slice(rows, func(i, j int) bool {
+			return rows[i].Sub < rows[j].Sub
+		})
+	}
+	return diff, nil
+}
@@ -0,0 +1,135 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/amoz0x/nether/internal/util"
+)
+
+// writeDelta stores rows as a delta for root taken at ts.
+func writeDelta(t *testing.T, c *Cache, root string, ts time.Time, rows ...Row) {
+	w, err := util.CreateZst(c.DeltaPath(root, ts))
+	if err != nil {
+		t.Fatalf("Failed to create delta: %v", err)
+	}
+	defer w.Close()
+	for _, row := range rows {
+		data, _ := json.Marshal(row)
+		fmt.Fprintln(w, string(data))
+	}
+}
+
+func TestDiffUsesDeltaWindow(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "blink-delta-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	c := &Cache{Base: tmpDir}
+	for _, dir := range []string{"cache", "deltas"} {
+		if err := os.MkdirAll(filepath.Join(tmpDir, dir), 0755); err != nil {
+			t.Fatalf("Failed to create %s dir: %v", dir, err)
+		}
+	}
+
+	day1 := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	day5 := day1.AddDate(0, 0, 4)
+	day9 := day1.AddDate(0, 0, 8)
+	stamp := func(ts time.Time) string { return ts.Format(time.RFC3339) }
+
+	// old and mid have deltas; late only has a cache row, as after a lost delta
+	writeDelta(t, c, "example.com", day1, Row{Sub: "old.example.com", FirstSeen: stamp(day1)})
+	writeDelta(t, c, "example.com", day5, Row{Sub: "mid.example.com", FirstSeen: stamp(day5), SrcBits: 1})
+	writeDelta(t, c, "sub.example.com", day5, Row{Sub: "x.sub.example.com", FirstSeen: stamp(day5)})
+	writeDelta(t, c, "example.com", day9, Row{Sub: "gone.example.com", FirstSeen: stamp(day1), Status: StatusRemoved})
+	if err := c.WriteRows("example.com", []Row{
+		{Sub: "old.example.com", FirstSeen: stamp(day1), LastSeen: stamp(day9)},
+		{Sub: "mid.example.com", FirstSeen: stamp(day5), LastSeen: stamp(day9), SrcBits: 3},
+		{Sub: "late.example.com", FirstSeen: stamp(day9), LastSeen: stamp(day9)},
+		{Sub: "gone.example.com", FirstSeen: stamp(day1), LastSeen: stamp(day1), Status: StatusRemoved, Misses: 5},
+	}); err != nil {
+		t.Fatalf("Failed to write rows: %v", err)
+	}
+
+	diff, err := c.Diff("example.com", day1.Add(time.Hour), day9)
+	if err != nil {
+		t.Fatalf("Diff failed: %v", err)
+	}
+
+	var subs []string
+	for _, row := range diff.Added {
+		subs = append(subs, row.Sub)
+	}
+	if fmt.Sprint(subs) != "[late.example.com mid.example.com]" {
+		t.Fatalf("Expected late and mid to be added, got %v", subs)
+	}
+	// Added rows carry current cache metadata rather than the delta snapshot
+	if diff.Added[1].SrcBits != 3 {
+		t.Errorf("Expected current src_bits 3, got %d", diff.Added[1].SrcBits)
+	}
+	if len(diff.Removed) != 1 || diff.Removed[0].Sub != "gone.example.com" {
+		t.Errorf("Expected gone.example.com to be removed, got %v", diff.Removed)
+	}
+
+	diff, err = c.Diff("example.com", day1, day1)
+	if err != nil {
+		t.Fatalf("Diff failed: %v", err)
+	}
+	if len(diff.Added) != 1 || diff.Added[0].Sub != "old.example.com" {
+		t.Errorf("Expected only old.example.com on day one, got %v", diff.Added)
+	}
+}
+
+func TestDiffSkipsRemovedHostsAddedAgain(t *testing.T) {
+	c := newTestCache(t)
+	if err := os.MkdirAll(filepath.Join(c.Base, "deltas"), 0755); err != nil {
+		t.Fatalf("Failed to create deltas dir: %v", err)
+	}
+
+	day1 := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	day5 := day1.AddDate(0, 0, 4)
+	day9 := day1.AddDate(0, 0, 8)
+	stamp := func(ts time.Time) string { return ts.Format(time.RFC3339) }
+
+	// back is removed in the window and added again after it; gone stays removed
+	writeDelta(t, c, "example.com", day5,
+		Row{Sub: "back.example.com", FirstSeen: stamp(day1), Status: StatusRemoved},
+		Row{Sub: "gone.example.com", FirstSeen: stamp(day1), Status: StatusRemoved},
+	)
+	writeDelta(t, c, "example.com", day9, Row{Sub: "back.example.com", FirstSeen: stamp(day9)})
+	if err := c.WriteRows("example.com", []Row{
+		{Sub: "back.example.com", FirstSeen: stamp(day9), LastSeen: stamp(day9)},
+		{Sub: "gone.example.com", FirstSeen: stamp(day1), LastSeen: stamp(day1), Status: StatusRemoved, Misses: 5},
+	}); err != nil {
+		t.Fatalf("Failed to write rows: %v", err)
+	}
+
+	diff, err := c.Diff("example.com", day1, day5)
+	if err != nil {
+		t.Fatalf("Diff failed: %v", err)
+	}
+	if len(diff.Added) != 0 {
+		t.Errorf("Expected nothing added, got %v", diff.Added)
+	}
+	if len(diff.Removed) != 1 || diff.Removed[0].Sub != "gone.example.com" {
+		t.Errorf("Expected only gone.example.com to be removed, got %v", diff.Removed)
+	}
+
+	// Without a delta for the re-add, the current row still shows it is back
+	if err := os.Remove(c.DeltaPath("example.com", day9)); err != nil {
+		t.Fatalf("Failed to remove delta: %v", err)
+	}
+	diff, err = c.Diff("example.com", day1, day5)
+	if err != nil {
+		t.Fatalf("Diff failed: %v", err)
+	}
+	if len(diff.Removed) != 1 || diff.Removed[0].Sub != "gone.example.com" {
+		t.Errorf("Expected only gone.example.com to be removed, got %v", diff.Removed)
+	}
+}
@@ -0,0 +1,368 @@
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/amoz0x/nether/internal/util"
+)
+
+// Kinds of files checked by Fsck.
+const (
+	FileShard = "shard"
+	FileLog   = "log"
+	FileDelta = "delta"
+	FileTemp  = "temp" // Left behind by an interrupted atomic write
+)
+
+// maxClockSkew is how far in the future a timestamp may lie before Fsck
+// reports it.
+const maxClockSkew = 24 * time.Hour
+
+// Problem is an integrity issue found in a cache file.
+type Problem struct {
+	Line  int    `json:"line,omitempty"` // 1-based line of the decompressed file, 0 for the file as a whole
+	Sub   string `json:"sub,omitempty"`
+	Issue string `json:"issue"`
+}
+
+// FileReport is the outcome of checking one file of a root.
+type FileReport struct {
+	Path        string    `json:"path"`
+	Kind        string    `json:"kind"`
+	Rows        int       `json:"rows"` // Lines that decoded as rows
+	Problems    []Problem `json:"problems,omitempty"`
+	Repaired    bool      `json:"repaired,omitempty"`
+	Quarantined string    `json:"quarantined,omitempty"` // Where the broken original was moved by a repair
+
+	salvaged []logEntry // Readable rows with fixable problems fixed, in file order
+}
+
+// QuarantinePath returns where a broken cache file with the given name is
+// moved by a repair.
+func (c *Cache) QuarantinePath(name string) string {
+	stamp := time.Now().UTC().Format(deltaTimeLayout)
+	return filepath.Join(c.Base, "quarantine", name+"."+stamp)
+}
+
+// Fsck checks the shard, log and deltas of root: that every zstd frame
+// decodes, every line is a row of the expected schema with a normalized
+// hostname under root and sane timestamps, and that the shard holds each
+// host once. Leftover temporary files are reported too. With repair set,
+// readable rows of broken files are salvaged into fresh files, the broken
+// originals are moved to the quarantine directory and temporary files are
+// removed. The root is locked for the duration.
+func (c *Cache) Fsck(root string, repair bool) ([]*FileReport, error) {
+	l, err := c.Lock(root)
+	if err != nil {
+		return nil, err
+	}
+	defer l.Unlock()
+
+	var reports []*FileReport
+	shard := checkFile(c.CachePath(root), root, FileShard)
+	log := checkFile(c.LogPath(root), root, FileLog)
+	for _, r := range []*FileReport{shard, log} {
+		if r != nil {
+			reports = append(reports, r)
+		}
+	}
+
+	deltas, err := c.Deltas(root)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range deltas {
+		if r := checkFile(d.Path, root, FileDelta); r != nil {
+			reports = append(reports, r)
+		}
+	}
+
+	temps, err := c.tempFiles(root)
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range temps {
+		reports = append(reports, &FileReport{
+			Path:     path,
+			Kind:     FileTemp,
+			Problems: []Problem{{Issue: "leftover temporary file from an interrupted write"}},
+		})
+	}
+
+	if repair {
+		if err := l.repair(shard, log, reports); err != nil {
+			return reports, err
+		}
+	}
+	return reports, nil
+}
+
+// FsckRoots returns every root with a shard, log or delta file.
+func (c *Cache) FsckRoots() []string {
+	roots := c.ListDomains()
+	seen := make(map[string]bool, len(roots))
+	for _, root := range roots {
+		seen[root] = true
+	}
+
+	matches, _ := filepath.Glob(filepath.Join(c.Base, "deltas", "*.delta-*.jsonl.zst"))
+	for _, path := range matches {
+		name := filepath.Base(path)
+		root := name[:strings.LastIndex(name, ".delta-")]
+		if !seen[root] {
+			seen[root] = true
+			roots = append(roots, root)
+		}
+	}
+	return roots
+}
+
+// tempFiles returns the temporary files of interrupted writes to root's
+// shard, metadata and deltas.
+func (c *Cache) tempFiles(root string) ([]string, error) {
+	var out []string
+	for _, pattern := range []string{
+		c.CachePath(root) + ".tmp-*",
+		c.MetaPath(root) + ".tmp-*",
+		filepath.Join(c.Base, "deltas", root+".delta-*.jsonl.zst.tmp-*"),
+	} {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list temporary files: %w", err)
+		}
+		out = append(out, matches...)
+	}
+	return out, nil
+}
+
+// repair salvages the broken files among reports. A broken shard or log is
+// folded into a fresh shard; a broken delta is rewritten with its readable
+// rows.
+func (l *Locked) repair(shard, log *FileReport, reports []*FileReport) error {
+	broken := func(r *FileReport) bool { return r != nil && len(r.Problems) > 0 }
+
+	if broken(shard) || broken(log) {
+		bySub := make(map[string]Row)
+		for _, r := range []*FileReport{shard, log} {
+			if r == nil {
+				continue
+			}
+			for _, entry := range r.salvaged {
+				if entry.Deleted {
+					delete(bySub, entry.Sub)
+				} else {
+					bySub[entry.Sub] = entry.Row
+				}
+			}
+		}
+
+		for _, r := range []*FileReport{shard, log} {
+			if broken(r) {
+				if err := l.c.quarantine(r); err != nil {
+					return err
+				}
+			}
+		}
+		if err := l.c.writeShard(l.root, sortedRows(bySub)); err != nil {
+			return err
+		}
+		if err := l.removeLog(); err != nil {
+			return err
+		}
+		for _, r := range []*FileReport{shard, log} {
+			if broken(r) {
+				r.Repaired = true
+			}
+		}
+	}
+
+	for _, r := range reports {
+		if !broken(r) || r.Repaired {
+			continue
+		}
+		switch r.Kind {
+		case FileDelta:
+			if err := l.c.quarantine(r); err != nil {
+				return err
+			}
+			if len(r.salvaged) > 0 {
+				rows := make([]Row, len(r.salvaged))
+				for i, entry := range r.salvaged {
+					rows[i] = entry.Row
+				}
+				err := util.WriteZstAtomic(r.Path, func(w io.Writer) error {
+					return writeJSONL(w, rows)
+				})
+				if err != nil {
+					return fmt.Errorf("failed to write delta file: %w", err)
+				}
+			}
+		case FileTemp:
+			if err := os.Remove(r.Path); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to remove temporary file: %w", err)
+			}
+		}
+		r.Repaired = true
+	}
+	return nil
+}
+
+// quarantine moves the file of r out of the cache.
+func (c *Cache) quarantine(r *FileReport) error {
+	dest, err := c.quarantineFile(r.Path)
+	if err != nil {
+		return err
+	}
+	r.Quarantined = dest
+	return nil
+}
+
+// quarantineFile moves the file at path to the quarantine directory and
+// returns its new path.
+func (c *Cache) quarantineFile(path string) (string, error) {
+	dest := c.QuarantinePath(filepath.Base(path))
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return "", fmt.Errorf("failed to create quarantine directory: %w", err)
+	}
+	if err := os.Rename(path, dest); err != nil {
+		return "", fmt.Errorf("failed to quarantine %s: %w", filepath.Base(path), err)
+	}
+	return dest, nil
+}
+
+// checkFile checks a shard, log or delta file of root. It returns nil if the
+// file doesn't exist.
+func checkFile(path, root, kind string) *FileReport {
+	reader, err := util.OpenZst(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	r := &FileReport{Path: path, Kind: kind}
+	if err != nil {
+		r.Problems = append(r.Problems, Problem{Issue: fmt.Sprintf("cannot open: %v", err)})
+		return r
+	}
+	defer reader.Close()
+
+	firstLine := make(map[string]int)
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64<<10), 16<<20)
+	line := 0
+	for scanner.Scan() {
+		line++
+		data := scanner.Bytes()
+		if len(data) == 0 {
+			continue
+		}
+
+		var entry logEntry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			r.Problems = append(r.Problems, Problem{Line: line, Issue: fmt.Sprintf("invalid JSON: %v", err)})
+			continue
+		}
+		r.Rows++
+		if entry.Deleted && kind != FileLog {
+			r.Problems = append(r.Problems, Problem{Line: line, Sub: entry.Sub, Issue: "tombstone outside the log"})
+			continue
+		}
+
+		strict := json.NewDecoder(bytes.NewReader(data))
+		strict.DisallowUnknownFields()
+		if err := strict.Decode(&logEntry{}); err != nil {
+			r.Problems = append(r.Problems, Problem{Line: line, Sub: entry.Sub, Issue: fmt.Sprintf("unexpected schema: %v", err)})
+		}
+
+		fixed, issues, keep := checkRow(entry, root)
+		for _, issue := range issues {
+			r.Problems = append(r.Problems, Problem{Line: line, Sub: entry.Sub, Issue: issue})
+		}
+		if !keep {
+			continue
+		}
+
+		if kind == FileShard {
+			if first, ok := firstLine[fixed.Sub]; ok {
+				r.Problems = append(r.Problems, Problem{Line: line, Sub: fixed.Sub, Issue: fmt.Sprintf("duplicate of line %d", first)})
+			} else {
+				firstLine[fixed.Sub] = line
+			}
+		}
+		r.salvaged = append(r.salvaged, fixed)
+	}
+	if err := scanner.Err(); err != nil {
+		r.Problems = append(r.Problems, Problem{Issue: fmt.Sprintf("unreadable after line %d: %v", line, err)})
+	}
+	return r
+}
+
+// checkRow validates an entry of root. It returns the entry with fixable
+// problems fixed, the problems found and whether the entry can be kept.
+func checkRow(entry logEntry, root string) (logEntry, []string, bool) {
+	var issues []string
+
+	host, reason := util.CheckHost(entry.Sub, root)
+	switch {
+	case reason == util.ReasonOutOfScope || reason == util.ReasonOtherDomain:
+		return entry, append(issues, "not a host of "+root), false
+	case reason != "":
+		return entry, append(issues, "invalid hostname: "+string(reason)), false
+	case host != entry.Sub:
+		issues = append(issues, fmt.Sprintf("hostname not normalized, should be %s", host))
+		entry.Sub = host
+	}
+	if entry.Deleted {
+		return entry, issues, true
+	}
+
+	switch entry.Status {
+	case "", StatusActive, StatusStale, StatusRemoved:
+	default:
+		issues = append(issues, fmt.Sprintf("unknown status %q", entry.Status))
+		entry.Status = ""
+	}
+	if entry.SrcBits < 0 || entry.Misses < 0 {
+		issues = append(issues, "negative src_bits or misses")
+		entry.SrcBits, entry.Misses = max(entry.SrcBits, 0), max(entry.Misses, 0)
+	}
+
+	now := time.Now().UTC()
+	var first, last time.Time
+	for _, ts := range []struct {
+		name  string
+		value *string
+		t     *time.Time
+	}{
+		{"first_seen", &entry.FirstSeen, &first},
+		{"last_seen", &entry.LastSeen, &last},
+	} {
+		if *ts.value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, *ts.value)
+		switch {
+		case err != nil:
+			issues = append(issues, fmt.Sprintf("invalid %s %q", ts.name, *ts.value))
+			*ts.value = ""
+		case t.After(now.Add(maxClockSkew)):
+			issues = append(issues, fmt.Sprintf("%s %s is in the future", ts.name, *ts.value))
+			*ts.value = now.Format(time.RFC3339)
+			*ts.t = now
+		default:
+			*ts.t = t
+		}
+	}
+	if !first.IsZero() && !last.IsZero() && first.After(last) {
+		issues = append(issues, "first_seen is after last_seen")
+		entry.FirstSeen = entry.LastSeen
+	}
+
+	return entry, issues, true
+}
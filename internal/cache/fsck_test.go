@@ -0,0 +1,144 @@
+package cache
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/amoz0x/nether/internal/util"
+)
+
+// writeRawShard writes lines as the shard of root, bypassing validation.
+func writeRawShard(t *testing.T, c *Cache, root string, lines ...string) {
+	err := util.WriteZstAtomic(c.CachePath(root), func(w io.Writer) error {
+		_, err := io.WriteString(w, strings.Join(lines, "\n")+"\n")
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Failed to write shard: %v", err)
+	}
+}
+
+func TestFsckRepairsShard(t *testing.T) {
+	c := newTestCache(t)
+	writeRawShard(t, c, "example.com",
+		`{"sub":"api.example.com","first_seen":"2024-01-01T00:00:00Z","last_seen":"2024-01-02T00:00:00Z","src_bits":1}`,
+		`{"sub":"broken.example.com",`,
+		`{"sub":"WWW.Example.com","src_bits":1}`,
+		`{"sub":"evil.other.com","src_bits":1}`,
+		`{"sub":"api.example.com","first_seen":"2024-01-01T00:00:00Z","last_seen":"2024-01-03T00:00:00Z","src_bits":3}`,
+		`{"sub":"old.example.com","first_seen":"2024-02-01T00:00:00Z","last_seen":"2024-01-01T00:00:00Z","src_bits":1}`,
+	)
+
+	reports, err := c.Fsck("example.com", false)
+	if err != nil {
+		t.Fatalf("Failed to check cache: %v", err)
+	}
+	if len(reports) != 1 || reports[0].Kind != FileShard {
+		t.Fatalf("Expected a report for the shard only, got %+v", reports)
+	}
+	var issues []string
+	for _, p := range reports[0].Problems {
+		issues = append(issues, p.Issue)
+	}
+	if len(issues) != 5 {
+		t.Fatalf("Expected 5 problems, got %q", issues)
+	}
+	if reports[0].Repaired {
+		t.Errorf("Expected no repair without repair set")
+	}
+
+	reports, err = c.Fsck("example.com", true)
+	if err != nil {
+		t.Fatalf("Failed to repair cache: %v", err)
+	}
+	if !reports[0].Repaired || reports[0].Quarantined == "" {
+		t.Fatalf("Expected the shard to be repaired and quarantined, got %+v", reports[0])
+	}
+	if _, err := os.Stat(reports[0].Quarantined); err != nil {
+		t.Errorf("Expected the original shard in quarantine: %v", err)
+	}
+
+	want := []Row{
+		{Sub: "api.example.com", FirstSeen: "2024-01-01T00:00:00Z", LastSeen: "2024-01-03T00:00:00Z", SrcBits: 3},
+		{Sub: "old.example.com", FirstSeen: "2024-01-01T00:00:00Z", LastSeen: "2024-01-01T00:00:00Z", SrcBits: 1},
+		{Sub: "www.example.com", SrcBits: 1},
+	}
+	rows, err := c.Rows("example.com")
+	if err != nil {
+		t.Fatalf("Failed to read rows: %v", err)
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("Expected %v, got %v", want, rows)
+	}
+
+	reports, err = c.Fsck("example.com", false)
+	if err != nil {
+		t.Fatalf("Failed to check cache: %v", err)
+	}
+	if len(reports[0].Problems) != 0 {
+		t.Errorf("Expected no problems after repair, got %+v", reports[0].Problems)
+	}
+}
+
+func TestFsckRepairsTruncatedDelta(t *testing.T) {
+	c := newTestCache(t)
+	if err := os.MkdirAll(filepath.Join(c.Base, "deltas"), 0755); err != nil {
+		t.Fatalf("Failed to create deltas dir: %v", err)
+	}
+	l, err := c.Lock("example.com")
+	if err != nil {
+		t.Fatalf("Failed to lock: %v", err)
+	}
+	if _, err := l.AppendDelta([]Row{{Sub: "api.example.com"}}); err != nil {
+		t.Fatalf("Failed to append delta: %v", err)
+	}
+	path, err := l.AppendDelta([]Row{{Sub: "www.example.com"}})
+	if err != nil {
+		t.Fatalf("Failed to append delta: %v", err)
+	}
+	l.Unlock()
+
+	// Cut the last frame short and leave a temporary file behind
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Failed to stat delta: %v", err)
+	}
+	if err := os.Truncate(path, info.Size()-4); err != nil {
+		t.Fatalf("Failed to truncate delta: %v", err)
+	}
+	temp := path + ".tmp-123"
+	if err := os.WriteFile(temp, nil, 0644); err != nil {
+		t.Fatalf("Failed to write temporary file: %v", err)
+	}
+
+	if roots := c.FsckRoots(); !reflect.DeepEqual(roots, []string{"example.com"}) {
+		t.Errorf("Expected example.com to be checked, got %v", roots)
+	}
+	reports, err := c.Fsck("example.com", true)
+	if err != nil {
+		t.Fatalf("Failed to repair cache: %v", err)
+	}
+	if len(reports) != 2 || reports[0].Kind != FileDelta || reports[1].Kind != FileTemp {
+		t.Fatalf("Expected reports for the delta and the temporary file, got %+v", reports)
+	}
+	for _, r := range reports {
+		if len(r.Problems) == 0 || !r.Repaired {
+			t.Errorf("Expected %s to be broken and repaired, got %+v", r.Path, r)
+		}
+	}
+
+	rows, err := c.ReadDelta(path)
+	if err != nil {
+		t.Fatalf("Failed to read repaired delta: %v", err)
+	}
+	if want := []Row{{Sub: "api.example.com"}}; !reflect.DeepEqual(rows, want) {
+		t.Errorf("Expected %v, got %v", want, rows)
+	}
+	if _, err := os.Stat(temp); !os.IsNotExist(err) {
+		t.Errorf("Expected the temporary file to be removed, got %v", err)
+	}
+}
@@ -0,0 +1,188 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/amoz0x/nether/internal/util"
+)
+
+// DefaultLockTimeout is how long the cache waits for a root locked by
+// another process before giving up.
+const DefaultLockTimeout = 30 * time.Second
+
+// LockPath returns the path to the lock file for a given root domain.
+func (c *Cache) LockPath(root string) string {
+	return filepath.Join(c.Base, "cache", root+".lock")
+}
+
+// lock takes the shared or exclusive lock of root.
+func (c *Cache) lock(root string, exclusive bool) (func(), error) {
+	timeout := c.LockTimeout
+	if timeout <= 0 {
+		timeout = DefaultLockTimeout
+	}
+
+	release, err := util.Lock(c.LockPath(root), exclusive, timeout)
+	if errors.Is(err, util.ErrLockTimeout) {
+		return nil, fmt.Errorf("cache of %s is locked by another process: %w", root, err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock cache of %s: %w", root, err)
+	}
+	return release, nil
+}
+
+// Locked is a root of the cache held under its exclusive lock, so that a
+// merge can read the rows and write its changes without another process
+// writing in between. Its methods must not be used after Unlock.
+type Locked struct {
+	c       *Cache
+	root    string
+	release func()
+}
+
+// Lock takes the exclusive lock of root, waiting up to the cache's
+// LockTimeout for other processes to release it. Locks are not reentrant:
+// while one is held, use its methods rather than those of the Cache for the
+// same root.
+func (c *Cache) Lock(root string) (*Locked, error) {
+	release, err := c.lock(root, true)
+	if err != nil {
+		return nil, err
+	}
+	return &Locked{c: c, root: root, release: release}, nil
+}
+
+// Unlock releases the lock.
+func (l *Locked) Unlock() {
+	l.release()
+}
+
+// Rows returns the rows of the root, see Cache.Rows. The readable rows of a
+// damaged log are folded into the shard right away, so later appends aren't
+// hidden behind it, and the log itself is quarantined: frames after the
+// damage may still be salvaged from it by hand.
+func (l *Locked) Rows() ([]Row, error) {
+	bySub, damaged, err := l.c.readRows(l.root, nil)
+	if err != nil {
+		return nil, err
+	}
+	rows := sortedRows(bySub)
+	if damaged {
+		// The shard is written first: replaying the log over it is harmless
+		if err := l.c.writeShard(l.root, rows); err != nil {
+			return nil, err
+		}
+		dest, err := l.c.quarantineFile(l.c.LogPath(l.root))
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(os.Stderr, "Warning: moved the damaged cache log of %s to %s\n", l.root, dest)
+	}
+	return rows, nil
+}
+
+// Lookup returns the current rows of the given hosts, keyed by host, in one
+// streaming pass that skips the lines of every other host without decoding
+// them, so a small merge doesn't load the whole root into memory. Hosts
+// without a row are left out.
+func (l *Locked) Lookup(subs map[string]bool) (map[string]Row, error) {
+	bySub, damaged, err := l.c.readRows(l.root, subs)
+	if err != nil {
+		return nil, err
+	}
+	if !damaged {
+		return bySub, nil
+	}
+
+	// Fold the readable rows of the log into the shard, see Rows
+	rows, err := l.Rows()
+	if err != nil {
+		return nil, err
+	}
+	bySub = make(map[string]Row, len(subs))
+	for _, row := range rows {
+		if subs[row.Sub] {
+			bySub[row.Sub] = row
+		}
+	}
+	return bySub, nil
+}
+
+// IterRows calls fn for every row of the root, see Cache.IterRows.
+func (l *Locked) IterRows(fn func(Row)) error {
+	rows, err := l.Rows()
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		fn(row)
+	}
+	return nil
+}
+
+// AppendRows records new or updated rows, see Cache.AppendRows.
+func (l *Locked) AppendRows(rows []Row) error {
+	entries := make([]logEntry, len(rows))
+	for i, row := range rows {
+		entries[i] = logEntry{Row: row}
+	}
+	return l.appendLog(entries)
+}
+
+// DeleteRows removes the rows of the given hosts, see Cache.DeleteRows.
+func (l *Locked) DeleteRows(subs []string) error {
+	entries := make([]logEntry, len(subs))
+	for i, sub := range subs {
+		entries[i] = logEntry{Row: Row{Sub: sub}, Deleted: true}
+	}
+	return l.appendLog(entries)
+}
+
+// AppendDelta writes rows to the delta file of the current second, see
+// Cache.AppendDelta. The file is replaced rather than appended to, so a
+// crash never leaves a truncated delta behind.
+func (l *Locked) AppendDelta(rows []Row) (string, error) {
+	if len(rows) == 0 {
+		return "", nil
+	}
+
+	path := l.c.DeltaPath(l.root, time.Now().UTC())
+	existing, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return "", fmt.Errorf("failed to read delta file: %w", err)
+	}
+
+	// Concatenated zstd frames decode as one stream
+	err = util.WriteAtomic(path, func(w io.Writer) error {
+		if _, err := w.Write(existing); err != nil {
+			return err
+		}
+		enc, err := util.NewZstWriter(w)
+		if err != nil {
+			return err
+		}
+		if err := writeJSONL(enc, rows); err != nil {
+			enc.Close()
+			return err
+		}
+		return enc.Close()
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to write delta file: %w", err)
+	}
+	return path, nil
+}
+
+// removeLog deletes the log of the root.
+func (l *Locked) removeLog() error {
+	if err := os.Remove(l.c.LogPath(l.root)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove cache log: %w", err)
+	}
+	return nil
+}
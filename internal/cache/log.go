@@ -0,0 +1,226 @@
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"unicode/utf8"
+
+	"github.com/amoz0x/nether/internal/util"
+)
+
+// The cache of a root is a compacted shard (CachePath) followed by an
+// append-only log (LogPath). Every AppendRows and DeleteRows call adds one
+// zstd frame of entries to the log, and reading replays the log over the
+// shard so the last write of a host wins. Compact folds the log back into
+// the shard once it has grown larger than the shard itself.
+
+// compactMinLog is the log size below which the log is never compacted
+// automatically.
+const compactMinLog = 256 << 10
+
+// logEntry is a line of the log: a row, or a tombstone removing the row of
+// Sub when Deleted is set.
+type logEntry struct {
+	Row
+	Deleted bool `json:"deleted,omitempty"`
+}
+
+// LogPath returns the path to the append log for a given root domain.
+func (c *Cache) LogPath(root string) string {
+	return filepath.Join(c.Base, "cache", root+".log.zst")
+}
+
+// AppendRows records new or updated rows of root, replacing earlier versions
+// of the same hosts. Only the given rows are written.
+func (c *Cache) AppendRows(root string, rows []Row) error {
+	l, err := c.Lock(root)
+	if err != nil {
+		return err
+	}
+	defer l.Unlock()
+	return l.AppendRows(rows)
+}
+
+// DeleteRows removes the rows of the given hosts from root.
+func (c *Cache) DeleteRows(root string, subs []string) error {
+	l, err := c.Lock(root)
+	if err != nil {
+		return err
+	}
+	defer l.Unlock()
+	return l.DeleteRows(subs)
+}
+
+// Compact rewrites the shard of root with the current rows and removes the
+// log.
+func (c *Cache) Compact(root string) error {
+	l, err := c.Lock(root)
+	if err != nil {
+		return err
+	}
+	defer l.Unlock()
+	return l.compact()
+}
+
+// appendLog writes entries to the log as a single zstd frame and compacts
+// the root if the log has outgrown the shard.
+func (l *Locked) appendLog(entries []logEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	writer, err := util.AppendZst(l.c.LogPath(l.root))
+	if err != nil {
+		return fmt.Errorf("failed to open cache log: %w", err)
+	}
+	if err := writeJSONL(writer, entries); err != nil {
+		writer.Close()
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("failed to write cache log: %w", err)
+	}
+
+	if l.c.needsCompaction(l.root) {
+		return l.compact()
+	}
+	return nil
+}
+
+// needsCompaction reports whether the log of root is large enough, and
+// larger than the shard, to be worth folding into it.
+func (c *Cache) needsCompaction(root string) bool {
+	log, err := os.Stat(c.LogPath(root))
+	if err != nil || log.Size() < compactMinLog {
+		return false
+	}
+	shard, err := os.Stat(c.CachePath(root))
+	return err != nil || log.Size() > shard.Size()
+}
+
+// compact folds the log into a new shard. Replaying a log over the shard it
+// was folded into changes nothing, so a crash between renaming the shard and
+// removing the log loses no data.
+func (l *Locked) compact() error {
+	rows, err := l.Rows()
+	if err != nil {
+		return err
+	}
+	if err := l.c.writeShard(l.root, rows); err != nil {
+		return err
+	}
+	return l.removeLog()
+}
+
+// readRows decodes the rows of root from its shard and log, keeping the last
+// version of each host and dropping deleted ones. With want set, only the
+// rows of hosts in it are decoded and returned. A crash during an
+// append leaves a truncated frame at the end of the log; the rows before it
+// are kept and damaged is set so a writer can fold them into a new shard.
+func (c *Cache) readRows(root string, want map[string]bool) (bySub map[string]Row, damaged bool, err error) {
+	bySub = make(map[string]Row)
+	if err := readEntries(c.CachePath(root), bySub, want); err != nil {
+		return nil, false, fmt.Errorf("failed to read cache file: %w", err)
+	}
+	if err := readEntries(c.LogPath(root), bySub, want); err != nil {
+		damaged = true
+	}
+	return bySub, damaged, nil
+}
+
+// readEntries applies the entries stored in path to bySub, skipping those
+// of hosts missing from want when it is set. A missing file has no entries.
+func readEntries(path string, bySub map[string]Row, want map[string]bool) error {
+	reader, err := util.OpenZst(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	return scanEntries(reader, want, func(entry logEntry) {
+		// Rows cached before hosts were stored as punycode may hold Unicode
+		if sub, err := util.ToASCII(entry.Sub); err == nil {
+			entry.Sub = sub
+		}
+		if want != nil && !want[entry.Sub] {
+			return
+		}
+		if entry.Deleted {
+			delete(bySub, entry.Sub)
+		} else {
+			bySub[entry.Sub] = entry.Row
+		}
+	})
+}
+
+// scanEntries calls fn for each JSON line of r, warning about lines that
+// fail to decode. With want set, lines of hosts missing from it are skipped
+// without being decoded.
+func scanEntries(r io.Reader, want map[string]bool, fn func(logEntry)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64<<10), 16<<20)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue // Skip blank lines
+		}
+		if want != nil {
+			if sub, ok := lineSub(line); ok && !want[string(sub)] {
+				continue
+			}
+		}
+
+		var entry logEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			// Log warning but continue
+			fmt.Fprintf(os.Stderr, "Warning: invalid JSON in cache: %s\n", line)
+			continue
+		}
+		fn(entry)
+	}
+	return scanner.Err()
+}
+
+// subPrefix starts every line written by writeJSONL, as sub is the first
+// field of Row.
+var subPrefix = []byte(`{"sub":"`)
+
+// lineSub returns the host of a cache line without decoding it. It fails
+// for lines that need a full decode: other layouts, escapes and non-ASCII
+// hosts cached before hosts were stored as punycode.
+func lineSub(line []byte) ([]byte, bool) {
+	if !bytes.HasPrefix(line, subPrefix) {
+		return nil, false
+	}
+	rest := line[len(subPrefix):]
+	for i, b := range rest {
+		switch {
+		case b == '"':
+			return rest[:i], true
+		case b == '\\' || b >= utf8.RuneSelf:
+			return nil, false
+		}
+	}
+	return nil, false
+}
+
+// sortedRows returns the rows of bySub sorted by subdomain.
+func sortedRows(bySub map[string]Row) []Row {
+	rows := make([]Row, 0, len(bySub))
+	for _, row := range bySub {
+		rows = append(rows, row)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		return rows[i].Sub < rows[j].Sub
+	})
+	return rows
+}
@@ -0,0 +1,140 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// newTestCache returns a cache in a temporary directory.
+func newTestCache(t *testing.T) *Cache {
+	tmpDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(tmpDir, "cache"), 0755); err != nil {
+		t.Fatalf("Failed to create cache dir: %v", err)
+	}
+	return &Cache{Base: tmpDir}
+}
+
+func TestAppendRowsLastWriteWins(t *testing.T) {
+	c := newTestCache(t)
+
+	if err := c.WriteRows("example.com", []Row{
+		{Sub: "api.example.com", SrcBits: 1},
+		{Sub: "www.example.com", SrcBits: 1},
+	}); err != nil {
+		t.Fatalf("Failed to write rows: %v", err)
+	}
+	if err := c.AppendRows("example.com", []Row{{Sub: "api.example.com", SrcBits: 3}, {Sub: "new.example.com", SrcBits: 2}}); err != nil {
+		t.Fatalf("Failed to append rows: %v", err)
+	}
+	if err := c.DeleteRows("example.com", []string{"www.example.com"}); err != nil {
+		t.Fatalf("Failed to delete rows: %v", err)
+	}
+
+	want := []Row{
+		{Sub: "api.example.com", SrcBits: 3},
+		{Sub: "new.example.com", SrcBits: 2},
+	}
+	rows, err := c.Rows("example.com")
+	if err != nil {
+		t.Fatalf("Failed to read rows: %v", err)
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Fatalf("Expected %v, got %v", want, rows)
+	}
+
+	// Compaction keeps the rows and drops the log
+	if err := c.Compact("example.com"); err != nil {
+		t.Fatalf("Failed to compact: %v", err)
+	}
+	if _, err := os.Stat(c.LogPath("example.com")); !os.IsNotExist(err) {
+		t.Errorf("Expected the log to be removed, got %v", err)
+	}
+	rows, err = c.Rows("example.com")
+	if err != nil {
+		t.Fatalf("Failed to read rows: %v", err)
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("Expected %v after compaction, got %v", want, rows)
+	}
+}
+
+func TestAppendRowsCompactsLargeLog(t *testing.T) {
+	c := newTestCache(t)
+
+	// A root written only through the log is still listed
+	if err := c.AppendRows("example.com", []Row{{Sub: "www.example.com"}}); err != nil {
+		t.Fatalf("Failed to append rows: %v", err)
+	}
+	if domains := c.ListDomains(); !reflect.DeepEqual(domains, []string{"example.com"}) {
+		t.Errorf("Expected example.com to be listed, got %v", domains)
+	}
+
+	// Hashed labels barely compress, so one batch outgrows compactMinLog
+	var batch []Row
+	for i := 0; i < 10000; i++ {
+		sum := sha256.Sum256([]byte{byte(i), byte(i >> 8)})
+		batch = append(batch, Row{Sub: hex.EncodeToString(sum[:30]) + ".example.com"})
+	}
+	if err := c.AppendRows("example.com", batch); err != nil {
+		t.Fatalf("Failed to append rows: %v", err)
+	}
+
+	if _, err := os.Stat(c.CachePath("example.com")); err != nil {
+		t.Fatalf("Expected the log to have been compacted into a shard: %v", err)
+	}
+	rows, err := c.Rows("example.com")
+	if err != nil {
+		t.Fatalf("Failed to read rows: %v", err)
+	}
+	if len(rows) != len(batch)+1 {
+		t.Errorf("Expected %d rows after compaction, got %d", len(batch)+1, len(rows))
+	}
+}
+
+func TestLockedRepairsTruncatedLog(t *testing.T) {
+	c := newTestCache(t)
+	if err := c.AppendRows("example.com", []Row{{Sub: "api.example.com"}}); err != nil {
+		t.Fatalf("Failed to append rows: %v", err)
+	}
+	if err := c.AppendRows("example.com", []Row{{Sub: "www.example.com"}}); err != nil {
+		t.Fatalf("Failed to append rows: %v", err)
+	}
+
+	// Cut the last frame short, as a crash during the append would
+	info, err := os.Stat(c.LogPath("example.com"))
+	if err != nil {
+		t.Fatalf("Failed to stat log: %v", err)
+	}
+	if err := os.Truncate(c.LogPath("example.com"), info.Size()-4); err != nil {
+		t.Fatalf("Failed to truncate log: %v", err)
+	}
+
+	l, err := c.Lock("example.com")
+	if err != nil {
+		t.Fatalf("Failed to lock: %v", err)
+	}
+	if _, err := l.Rows(); err != nil {
+		t.Fatalf("Failed to read rows: %v", err)
+	}
+	if err := l.AppendRows([]Row{{Sub: "new.example.com"}}); err != nil {
+		t.Fatalf("Failed to append rows: %v", err)
+	}
+	l.Unlock()
+
+	subs, err := c.List("example.com")
+	if err != nil {
+		t.Fatalf("Failed to list rows: %v", err)
+	}
+	if want := []string{"api.example.com", "new.example.com"}; !reflect.DeepEqual(subs, want) {
+		t.Errorf("Expected %v, got %v", want, subs)
+	}
+	// The damaged log is kept for salvage rather than deleted
+	quarantined, err := filepath.Glob(filepath.Join(c.Base, "quarantine", "example.com.log.zst.*"))
+	if err != nil || len(quarantined) != 1 {
+		t.Errorf("Expected the damaged log in quarantine, got %v (%v)", quarantined, err)
+	}
+}
@@ -0,0 +1,97 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/amoz0x/nether/internal/util"
+)
+
+// WildcardZone records a zone found to answer for arbitrary labels.
+type WildcardZone struct {
+	Zone       string   `json:"zone"`
+	Answers    []string `json:"answers"`
+	DetectedAt string   `json:"detected_at"`
+}
+
+// Meta holds per-root scan metadata stored next to the cache file.
+type Meta struct {
+	Wildcards []WildcardZone `json:"wildcards,omitempty"`
+}
+
+// MetaPath returns the path to the metadata file for a given root domain.
+func (c *Cache) MetaPath(root string) string {
+	return filepath.Join(c.Base, "cache", root+".meta.json")
+}
+
+// ReadMeta loads the metadata for root. A missing file yields empty metadata.
+func (c *Cache) ReadMeta(root string) (Meta, error) {
+	var meta Meta
+
+	data, err := os.ReadFile(c.MetaPath(root))
+	if os.IsNotExist(err) {
+		return meta, nil
+	}
+	if err != nil {
+		return meta, fmt.Errorf("failed to read metadata: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return meta, fmt.Errorf("failed to parse metadata: %w", err)
+	}
+	return meta, nil
+}
+
+// WriteMeta saves the metadata for root, replacing the file atomically.
+func (c *Cache) WriteMeta(root string, meta Meta) error {
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal metadata: %w", err)
+	}
+
+	if err := util.WriteFileAtomic(c.MetaPath(root), data); err != nil {
+		return fmt.Errorf("failed to write metadata: %w", err)
+	}
+	return nil
+}
+
+// RecordWildcards merges detected wildcard zones into the metadata for root,
+// replacing earlier entries for the same zone. The root is locked so
+// concurrent scans don't lose each other's zones.
+func (c *Cache) RecordWildcards(root string, zones []WildcardZone) error {
+	if len(zones) == 0 {
+		return nil
+	}
+
+	l, err := c.Lock(root)
+	if err != nil {
+		return err
+	}
+	defer l.Unlock()
+
+	meta, err := c.ReadMeta(root)
+	if err != nil {
+		return err
+	}
+
+	byZone := make(map[string]WildcardZone)
+	for _, z := range meta.Wildcards {
+		byZone[z.Zone] = z
+	}
+	for _, z := range zones {
+		byZone[z.Zone] = z
+	}
+
+	meta.Wildcards = meta.Wildcards[:0]
+	for _, z := range byZone {
+		meta.Wildcards = append(meta.Wildcards, z)
+	}
+	sort.Slice(meta.Wildcards, func(i, j int) bool {
+		return meta.Wildcards[i].Zone < meta.Wildcards[j].Zone
+	})
+
+	return c.WriteMeta(root, meta)
+}
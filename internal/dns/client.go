@@ -0,0 +1,373 @@
+// Package dns provides a small concurrent DNS client used by the native discovery sources.
+package dns
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// Type is a DNS record type.
+type Type = dnsmessage.Type
+
+// Record types used by nether.
+const (
+	TypeA     = dnsmessage.TypeA
+	TypeAAAA  = dnsmessage.TypeAAAA
+	TypeCNAME = dnsmessage.TypeCNAME
+)
+
+// DefaultResolvers are public recursive resolvers used when none are configured.
+var DefaultResolvers = []string{
+	"1.1.1.1:53",
+	"8.8.8.8:53",
+	"9.9.9.9:53",
+	"1.0.0.1:53",
+	"8.8.4.4:53",
+}
+
+// Answer holds the records returned for a single query.
+type Answer struct {
+	Name  string
+	RCode dnsmessage.RCode
+	A     []string
+	AAAA  []string
+	CNAME []string // Canonical names in resolution order
+	Raw   *dnsmessage.Message
+}
+
+// NXDomain reports whether the server answered that the name does not exist.
+func (a *Answer) NXDomain() bool {
+	return a.RCode == dnsmessage.RCodeNameError
+}
+
+// Exists reports whether the name resolved to at least one record.
+func (a *Answer) Exists() bool {
+	return a.RCode == dnsmessage.RCodeSuccess && len(a.A)+len(a.AAAA)+len(a.CNAME) > 0
+}
+
+// Client sends queries to a rotating set of resolvers.
+type Client struct {
+	Servers []string      // Resolver addresses in host:port form
+	Timeout time.Duration // Per-attempt timeout
+	Retries int           // Additional attempts on timeouts and server failures
+
+	next    uint32
+	limiter *limiter
+}
+
+// NewClient creates a client for the given resolvers. Addresses without a port
+// default to port 53; an empty list falls back to DefaultResolvers. A positive
+// qps caps the total query rate across all goroutines sharing the client.
+func NewClient(servers []string, qps int) *Client {
+	var addrs []string
+	for _, s := range servers {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(s); err != nil {
+			s = net.JoinHostPort(s, "53")
+		}
+		addrs = append(addrs, s)
+	}
+	if len(addrs) == 0 {
+		addrs = append(addrs, DefaultResolvers...)
+	}
+
+	c := &Client{
+		Servers: addrs,
+		Timeout: 2 * time.Second,
+		Retries: 2,
+	}
+	if qps > 0 {
+		c.limiter = &limiter{interval: time.Second / time.Duration(qps)}
+	}
+	return c
+}
+
+// WithServers returns a client for other servers that shares the query rate
+// limit of c.
+func (c *Client) WithServers(servers []string) *Client {
+	other := NewClient(servers, 0)
+	other.Timeout = c.Timeout
+	other.Retries = c.Retries
+	other.limiter = c.limiter
+	return other
+}
+
+// Query sends a single question and returns the parsed answer, following any
+// CNAME chain present in the answer section. Transport failures are returned
+// as errors; NXDOMAIN and empty answers are not.
+func (c *Client) Query(ctx context.Context, name string, qtype Type) (*Answer, error) {
+	msg, err := c.Exchange(ctx, name, qtype)
+	if err != nil {
+		return nil, err
+	}
+	return parseAnswer(name, msg), nil
+}
+
+// Resolve queries both A and AAAA records for name and merges the results.
+func (c *Client) Resolve(ctx context.Context, name string) (*Answer, error) {
+	a, err := c.Query(ctx, name, TypeA)
+	if err != nil {
+		return nil, err
+	}
+	if a.NXDomain() {
+		return a, nil
+	}
+
+	aaaa, err := c.Query(ctx, name, TypeAAAA)
+	if err != nil {
+		// The A lookup already succeeded; an IPv6 failure is not fatal
+		return a, nil
+	}
+	a.AAAA = aaaa.AAAA
+	if len(a.CNAME) == 0 {
+		a.CNAME = aaaa.CNAME
+	}
+	return a, nil
+}
+
+// Exchange sends a query for name and returns the raw response message.
+func (c *Client) Exchange(ctx context.Context, name string, qtype Type) (*dnsmessage.Message, error) {
+	q, err := dnsmessage.NewName(fqdn(name))
+	if err != nil {
+		return nil, fmt.Errorf("invalid name %q: %w", name, err)
+	}
+
+	var lastErr error
+	for attempt := 0; attempt <= c.Retries; attempt++ {
+		if err := c.wait(ctx); err != nil {
+			return nil, err
+		}
+
+		server := c.pick()
+		msg, err := c.exchange(ctx, server, q, qtype)
+		if err == nil {
+			switch msg.RCode {
+			case dnsmessage.RCodeServerFailure, dnsmessage.RCodeRefused:
+				lastErr = fmt.Errorf("%s answered %s for %s", server, msg.RCode, name)
+				continue
+			}
+			return msg, nil
+		}
+		lastErr = err
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+
+	return nil, lastErr
+}
+
+// exchange performs one UDP round trip, retrying over TCP when truncated.
+func (c *Client) exchange(ctx context.Context, server string, q dnsmessage.Name, qtype Type) (*dnsmessage.Message, error) {
+	id := uint16(rand.Intn(1 << 16))
+	query := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: id, RecursionDesired: true},
+		Questions: []dnsmessage.Question{{Name: q, Type: qtype, Class: dnsmessage.ClassINET}},
+	}
+	packed, err := query.Pack()
+	if err != nil {
+		return nil, fmt.Errorf("failed to pack query: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+	defer cancel()
+
+	msg, err := exchangeUDP(ctx, server, packed, id)
+	if err != nil {
+		return nil, err
+	}
+	if msg.Truncated {
+		return exchangeTCP(ctx, server, packed, id)
+	}
+	return msg, nil
+}
+
+func exchangeUDP(ctx context.Context, server string, packed []byte, id uint16) (*dnsmessage.Message, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if _, err := conn.Write(packed); err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, 4096)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		var msg dnsmessage.Message
+		if err := msg.Unpack(buf[:n]); err != nil {
+			continue // Ignore garbage and keep waiting for our reply
+		}
+		if msg.ID != id {
+			continue
+		}
+		return &msg, nil
+	}
+}
+
+func exchangeTCP(ctx context.Context, server string, packed []byte, id uint16) (*dnsmessage.Message, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if err := writeTCP(conn, packed); err != nil {
+		return nil, err
+	}
+	buf, err := readTCP(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	var msg dnsmessage.Message
+	if err := msg.Unpack(buf); err != nil {
+		return nil, fmt.Errorf("failed to unpack response: %w", err)
+	}
+	if msg.ID != id {
+		return nil, fmt.Errorf("mismatched response ID from %s", server)
+	}
+	return &msg, nil
+}
+
+// writeTCP writes a length-prefixed DNS message.
+func writeTCP(w io.Writer, packed []byte) error {
+	buf := make([]byte, 2+len(packed))
+	binary.BigEndian.PutUint16(buf, uint16(len(packed)))
+	copy(buf[2:], packed)
+	_, err := w.Write(buf)
+	return err
+}
+
+// readTCP reads a length-prefixed DNS message.
+func readTCP(r io.Reader) ([]byte, error) {
+	var hdr [2]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, binary.BigEndian.Uint16(hdr[:]))
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// parseAnswer extracts address records and the CNAME chain for name.
+func parseAnswer(name string, msg *dnsmessage.Message) *Answer {
+	ans := &Answer{Name: canonical(name), RCode: msg.RCode, Raw: msg}
+
+	cnames := make(map[string]string)
+	for _, rr := range msg.Answers {
+		if body, ok := rr.Body.(*dnsmessage.CNAMEResource); ok {
+			cnames[canonical(rr.Header.Name.String())] = canonical(body.CNAME.String())
+		}
+	}
+
+	// Follow the chain from the queried name so unrelated records are ignored
+	target := ans.Name
+	for i := 0; i < 16; i++ {
+		next, ok := cnames[target]
+		if !ok {
+			break
+		}
+		ans.CNAME = append(ans.CNAME, next)
+		target = next
+	}
+
+	for _, rr := range msg.Answers {
+		if canonical(rr.Header.Name.String()) != target {
+			continue
+		}
+		switch body := rr.Body.(type) {
+		case *dnsmessage.AResource:
+			ans.A = append(ans.A, net.IP(body.A[:]).String())
+		case *dnsmessage.AAAAResource:
+			ans.AAAA = append(ans.AAAA, net.IP(body.AAAA[:]).String())
+		}
+	}
+
+	return ans
+}
+
+// pick returns the next resolver in round-robin order.
+func (c *Client) pick() string {
+	n := atomic.AddUint32(&c.next, 1)
+	return c.Servers[int(n-1)%len(c.Servers)]
+}
+
+func (c *Client) wait(ctx context.Context) error {
+	if c.limiter == nil {
+		return nil
+	}
+	return c.limiter.wait(ctx)
+}
+
+// fqdn returns name with a trailing dot.
+func fqdn(name string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+	return name + "."
+}
+
+// canonical lowercases name and strips the trailing dot.
+func canonical(name string) string {
+	return strings.TrimSuffix(strings.ToLower(name), ".")
+}
+
+// limiter spaces out queries to honour a global rate.
+type limiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+func (l *limiter) wait(ctx context.Context) error {
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	at := l.next
+	l.next = l.next.Add(l.interval)
+	l.mu.Unlock()
+
+	d := time.Until(at)
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,52 @@
+package dns
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// TypePTR is the pointer record type used for reverse lookups.
+const TypePTR = dnsmessage.TypePTR
+
+// ReverseName returns the in-addr.arpa or ip6.arpa name of addr.
+func ReverseName(addr netip.Addr) string {
+	addr = addr.Unmap()
+	if addr.Is4() {
+		b := addr.As4()
+		return fmt.Sprintf("%d.%d.%d.%d.in-addr.arpa", b[3], b[2], b[1], b[0])
+	}
+
+	const hex = "0123456789abcdef"
+	b := addr.As16()
+	var sb strings.Builder
+	for i := len(b) - 1; i >= 0; i-- {
+		sb.WriteByte(hex[b[i]&0x0f])
+		sb.WriteByte('.')
+		sb.WriteByte(hex[b[i]>>4])
+		sb.WriteByte('.')
+	}
+	sb.WriteString("ip6.arpa")
+	return sb.String()
+}
+
+// LookupPTR returns the names addr points back at. An address without PTR
+// records yields no names and no error.
+func (c *Client) LookupPTR(ctx context.Context, addr netip.Addr) ([]string, error) {
+	name := ReverseName(addr)
+	msg, err := c.Exchange(ctx, name, TypePTR)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, rr := range msg.Answers {
+		if body, ok := rr.Body.(*dnsmessage.PTRResource); ok {
+			names = append(names, canonical(body.PTR.String()))
+		}
+	}
+	return names, nil
+}
@@ -0,0 +1,261 @@
+package dns
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Wildcard describes a zone that answers for arbitrary labels.
+type Wildcard struct {
+	Zone    string   // Zone covered by the wildcard, e.g. dev.example.com
+	Answers []string // Addresses and "cname:" targets returned for random labels
+}
+
+// answerSet is the comparable form of a DNS answer.
+type answerSet struct {
+	ips   map[string]bool
+	cname string // Final CNAME target, if any
+}
+
+func newAnswerSet(ans *Answer) answerSet {
+	set := answerSet{ips: make(map[string]bool)}
+	for _, ip := range ans.A {
+		set.ips[ip] = true
+	}
+	for _, ip := range ans.AAAA {
+		set.ips[ip] = true
+	}
+	if len(ans.CNAME) > 0 {
+		set.cname = ans.CNAME[len(ans.CNAME)-1]
+	}
+	return set
+}
+
+// zoneResult is the wildcard probe outcome for one zone. It is not modified
+// once detect returns it.
+type zoneResult struct {
+	wildcard bool
+	ips      map[string]bool
+	cnames   map[string]bool
+}
+
+// zoneEntry caches the probe outcome of a zone once a probe got an answer.
+// Its mutex keeps concurrent lookups from probing the zone more than once.
+type zoneEntry struct {
+	mu     sync.Mutex
+	result *zoneResult // nil until probed successfully
+}
+
+// matches reports whether a candidate's answer is explained by the wildcard.
+func (z *zoneResult) matches(set answerSet) bool {
+	if set.cname != "" {
+		return z.cnames[set.cname]
+	}
+	if len(set.ips) == 0 {
+		return false
+	}
+	for ip := range set.ips {
+		if !z.ips[ip] {
+			return false
+		}
+	}
+	return true
+}
+
+// WildcardDetector finds wildcard zones under a root and filters candidates
+// that only resolve because of them. It is safe for concurrent use.
+type WildcardDetector struct {
+	Probes  int // Random labels queried per zone (default 2)
+	Workers int // Concurrent candidate checks (default 20)
+
+	client *Client
+	mu     sync.Mutex
+	zones  map[string]*zoneEntry
+}
+
+// NewWildcardDetector creates a detector that queries through client.
+func NewWildcardDetector(client *Client) *WildcardDetector {
+	return &WildcardDetector{
+		Probes:  2,
+		Workers: 20,
+		client:  client,
+		zones:   make(map[string]*zoneEntry),
+	}
+}
+
+// Filter splits candidates under root into names to keep and names whose
+// answers match the wildcard of their closest wildcarded parent zone.
+// Names that cannot be resolved are kept, since passive sources often report
+// hosts that are only reachable internally.
+func (d *WildcardDetector) Filter(ctx context.Context, root string, candidates []string) (kept, dropped []string) {
+	root = canonical(root)
+
+	type verdict struct {
+		host string
+		drop bool
+	}
+
+	jobs := make(chan string)
+	results := make(chan verdict)
+	var wg sync.WaitGroup
+
+	workers := d.Workers
+	if workers <= 0 {
+		workers = 20
+	}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for host := range jobs {
+				results <- verdict{host: host, drop: d.isWildcardHit(ctx, root, host)}
+			}
+		}()
+	}
+
+	go func() {
+		for _, host := range candidates {
+			jobs <- host
+		}
+		close(jobs)
+		wg.Wait()
+		close(results)
+	}()
+
+	for v := range results {
+		if v.drop {
+			dropped = append(dropped, v.host)
+		} else {
+			kept = append(kept, v.host)
+		}
+	}
+
+	sort.Strings(kept)
+	sort.Strings(dropped)
+	return kept, dropped
+}
+
+// Wildcards returns every zone found to be wildcarded by earlier Filter calls.
+func (d *WildcardDetector) Wildcards() []Wildcard {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var out []Wildcard
+	for zone, entry := range d.zones {
+		entry.mu.Lock()
+		z := entry.result
+		entry.mu.Unlock()
+		if z == nil || !z.wildcard {
+			continue
+		}
+		w := Wildcard{Zone: zone}
+		for ip := range z.ips {
+			w.Answers = append(w.Answers, ip)
+		}
+		for target := range z.cnames {
+			w.Answers = append(w.Answers, "cname:"+target)
+		}
+		sort.Strings(w.Answers)
+		out = append(out, w)
+	}
+
+	sort.Slice(out, func(i, j int) bool { return out[i].Zone < out[j].Zone })
+	return out
+}
+
+// isWildcardHit reports whether host should be discarded as wildcard noise.
+func (d *WildcardDetector) isWildcardHit(ctx context.Context, root, host string) bool {
+	host = canonical(host)
+	if host == root || !strings.HasSuffix(host, "."+root) {
+		return false
+	}
+
+	// Walk from the closest parent up to the root; the nearest wildcard wins
+	var zone *zoneResult
+	for parent := parentZone(host); ; parent = parentZone(parent) {
+		if z := d.detect(ctx, parent); z.wildcard {
+			zone = z
+			break
+		}
+		if parent == root {
+			break
+		}
+	}
+	if zone == nil {
+		return false
+	}
+
+	ans, err := d.client.Query(ctx, host, TypeA)
+	if err != nil || !ans.Exists() {
+		return false
+	}
+	return zone.matches(newAnswerSet(ans))
+}
+
+// detect probes zone with random labels, caching the outcome. When every
+// probe fails, such as on SERVFAIL, a timeout or a cancelled ctx, the zone is
+// reported as not wildcarded for now and probed again on the next call.
+func (d *WildcardDetector) detect(ctx context.Context, zone string) *zoneResult {
+	d.mu.Lock()
+	entry, ok := d.zones[zone]
+	if !ok {
+		entry = &zoneEntry{}
+		d.zones[zone] = entry
+	}
+	d.mu.Unlock()
+
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	if entry.result != nil {
+		return entry.result
+	}
+
+	z := &zoneResult{ips: make(map[string]bool), cnames: make(map[string]bool)}
+	probes := d.Probes
+	if probes <= 0 {
+		probes = 2
+	}
+	answered := false
+	for i := 0; i < probes; i++ {
+		ans, err := d.client.Query(ctx, randomLabel()+"."+zone, TypeA)
+		if err != nil {
+			continue
+		}
+		answered = true
+		if !ans.Exists() {
+			continue
+		}
+		z.wildcard = true
+		set := newAnswerSet(ans)
+		for ip := range set.ips {
+			z.ips[ip] = true
+		}
+		if set.cname != "" {
+			z.cnames[set.cname] = true
+		}
+	}
+
+	if answered {
+		entry.result = z
+	}
+	return z
+}
+
+// parentZone strips the leftmost label from name.
+func parentZone(name string) string {
+	if i := strings.IndexByte(name, '.'); i >= 0 {
+		return name[i+1:]
+	}
+	return ""
+}
+
+// randomLabel returns a label that is vanishingly unlikely to exist.
+func randomLabel() string {
+	var b [8]byte
+	rand.Read(b[:])
+	return "nether-wc-" + hex.EncodeToString(b[:])
+}
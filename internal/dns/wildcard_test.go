@@ -0,0 +1,106 @@
+package dns
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/amoz0x/nether/internal/dnstest"
+)
+
+func TestWildcardDetectorFiltersNestedWildcards(t *testing.T) {
+	srv, err := dnstest.NewServer()
+	if err != nil {
+		t.Fatalf("Failed to start DNS server: %v", err)
+	}
+	defer srv.Close()
+
+	// *.example.com is a CNAME to a parking page, *.dev.example.com is a plain A wildcard
+	srv.AddCNAME("*.example.com", "parking.example.net")
+	srv.AddA("parking.example.net", "192.0.2.1")
+	srv.AddA("*.dev.example.com", "192.0.2.9")
+	srv.AddA("dev.example.com", "192.0.2.8")
+	srv.AddA("www.example.com", "192.0.2.2")
+	srv.AddA("api.dev.example.com", "192.0.2.3")
+
+	detector := NewWildcardDetector(NewClient([]string{srv.Addr}, 0))
+	candidates := []string{
+		"www.example.com",
+		"random.example.com",
+		"api.dev.example.com",
+		"junk.dev.example.com",
+		"deep.junk.dev.example.com",
+	}
+
+	kept, dropped := detector.Filter(context.Background(), "example.com", candidates)
+
+	expectedKept := []string{"api.dev.example.com", "www.example.com"}
+	if !reflect.DeepEqual(kept, expectedKept) {
+		t.Errorf("Expected kept %v, got %v", expectedKept, kept)
+	}
+
+	expectedDropped := []string{"deep.junk.dev.example.com", "junk.dev.example.com", "random.example.com"}
+	if !reflect.DeepEqual(dropped, expectedDropped) {
+		t.Errorf("Expected dropped %v, got %v", expectedDropped, dropped)
+	}
+
+	wildcards := detector.Wildcards()
+	var zones []string
+	for _, w := range wildcards {
+		zones = append(zones, w.Zone)
+	}
+	// junk.dev.example.com is covered by *.dev.example.com and is reported as a zone too
+	expectedZones := []string{"dev.example.com", "example.com", "junk.dev.example.com"}
+	if !reflect.DeepEqual(zones, expectedZones) {
+		t.Errorf("Expected wildcard zones %v, got %v", expectedZones, zones)
+	}
+}
+
+func TestWildcardDetectorNoWildcard(t *testing.T) {
+	srv, err := dnstest.NewServer()
+	if err != nil {
+		t.Fatalf("Failed to start DNS server: %v", err)
+	}
+	defer srv.Close()
+
+	srv.AddA("example.com", "192.0.2.1")
+	srv.AddA("www.example.com", "192.0.2.2")
+
+	detector := NewWildcardDetector(NewClient([]string{srv.Addr}, 0))
+	kept, dropped := detector.Filter(context.Background(), "example.com", []string{"www.example.com", "gone.example.com"})
+
+	if len(kept) != 2 || len(dropped) != 0 {
+		t.Errorf("Expected all candidates kept, got kept=%v dropped=%v", kept, dropped)
+	}
+	if len(detector.Wildcards()) != 0 {
+		t.Errorf("Expected no wildcard zones, got %v", detector.Wildcards())
+	}
+}
+
+func TestWildcardDetectorRetriesFailedProbes(t *testing.T) {
+	srv, err := dnstest.NewServer()
+	if err != nil {
+		t.Fatalf("Failed to start DNS server: %v", err)
+	}
+	defer srv.Close()
+
+	srv.AddA("*.example.com", "192.0.2.1")
+
+	detector := NewWildcardDetector(NewClient([]string{srv.Addr}, 0))
+	candidates := []string{"random.example.com"}
+
+	// Every probe fails on a cancelled context, which says nothing about the zone
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, dropped := detector.Filter(ctx, "example.com", candidates); len(dropped) != 0 {
+		t.Errorf("Expected nothing dropped without answers, got %v", dropped)
+	}
+
+	kept, dropped := detector.Filter(context.Background(), "example.com", candidates)
+	if len(kept) != 0 || !reflect.DeepEqual(dropped, candidates) {
+		t.Errorf("Expected the wildcard to be detected on retry, got kept=%v dropped=%v", kept, dropped)
+	}
+	if len(detector.Wildcards()) != 1 {
+		t.Errorf("Expected one wildcard zone, got %v", detector.Wildcards())
+	}
+}
@@ -0,0 +1,188 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"strings"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// Zone record types. NSEC is not defined by dnsmessage and is parsed from the
+// raw record data.
+const (
+	TypeNS   = dnsmessage.TypeNS
+	TypeSOA  = dnsmessage.TypeSOA
+	TypeAXFR = dnsmessage.TypeAXFR
+	TypeNSEC = Type(47)
+)
+
+// ErrNoNSEC is returned by NextSecure when the server has no NSEC record for
+// the name, typically because the zone is unsigned or uses NSEC3.
+var ErrNoNSEC = errors.New("no NSEC record")
+
+// maxWalk caps the names collected by a single NSEC walk.
+const maxWalk = 100000
+
+// Nameservers returns the NS host names of zone.
+func (c *Client) Nameservers(ctx context.Context, zone string) ([]string, error) {
+	msg, err := c.Exchange(ctx, zone, TypeNS)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, rr := range msg.Answers {
+		if body, ok := rr.Body.(*dnsmessage.NSResource); ok {
+			names = append(names, canonical(body.NS.String()))
+		}
+	}
+	return names, nil
+}
+
+// Transfer requests a full zone transfer (AXFR) of zone from server over TCP
+// and returns the owner name of every record in it. Servers that refuse the
+// transfer yield an error.
+func Transfer(ctx context.Context, server, zone string) ([]string, error) {
+	q, err := dnsmessage.NewName(fqdn(zone))
+	if err != nil {
+		return nil, fmt.Errorf("invalid name %q: %w", zone, err)
+	}
+	id := uint16(rand.Intn(1 << 16))
+	query := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: id},
+		Questions: []dnsmessage.Question{{Name: q, Type: TypeAXFR, Class: dnsmessage.ClassINET}},
+	}
+	packed, err := query.Pack()
+	if err != nil {
+		return nil, fmt.Errorf("failed to pack query: %w", err)
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if err := writeTCP(conn, packed); err != nil {
+		return nil, err
+	}
+
+	// The transfer starts and ends with the zone's SOA record and may span
+	// any number of messages in between
+	var names []string
+	seen := make(map[string]bool)
+	soas := 0
+	for soas < 2 {
+		buf, err := readTCP(conn)
+		if err != nil {
+			return nil, fmt.Errorf("transfer from %s interrupted: %w", server, err)
+		}
+		var msg dnsmessage.Message
+		if err := msg.Unpack(buf); err != nil {
+			return nil, fmt.Errorf("failed to unpack response: %w", err)
+		}
+		if msg.ID != id {
+			return nil, fmt.Errorf("mismatched response ID from %s", server)
+		}
+		if msg.RCode != dnsmessage.RCodeSuccess {
+			return nil, fmt.Errorf("%s answered %s for transfer of %s", server, msg.RCode, zone)
+		}
+		if len(msg.Answers) == 0 {
+			return nil, fmt.Errorf("%s sent an empty transfer of %s", server, zone)
+		}
+
+		for i, rr := range msg.Answers {
+			if rr.Header.Type == TypeSOA {
+				soas++
+			} else if soas == 0 && i == 0 {
+				return nil, fmt.Errorf("%s sent a transfer of %s without a leading SOA", server, zone)
+			}
+			name := canonical(rr.Header.Name.String())
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	return names, nil
+}
+
+// NextSecure queries the NSEC record owned by name and returns the next owner
+// name in the zone's canonical order.
+func (c *Client) NextSecure(ctx context.Context, name string) (string, error) {
+	msg, err := c.Exchange(ctx, name, TypeNSEC)
+	if err != nil {
+		return "", err
+	}
+
+	want := canonical(name)
+	for _, rr := range msg.Answers {
+		if rr.Header.Type != TypeNSEC || canonical(rr.Header.Name.String()) != want {
+			continue
+		}
+		body, ok := rr.Body.(*dnsmessage.UnknownResource)
+		if !ok {
+			continue
+		}
+		next, err := wireName(body.Data)
+		if err != nil {
+			return "", fmt.Errorf("malformed NSEC record for %s: %w", name, err)
+		}
+		return next, nil
+	}
+	return "", ErrNoNSEC
+}
+
+// WalkNSEC enumerates a DNSSEC-signed zone by following its NSEC chain from
+// the apex until it wraps around, returning every owner name below the apex.
+func (c *Client) WalkNSEC(ctx context.Context, zone string) ([]string, error) {
+	zone = canonical(zone)
+	var names []string
+	seen := map[string]bool{zone: true}
+
+	cur := zone
+	for len(names) < maxWalk {
+		next, err := c.NextSecure(ctx, cur)
+		if err != nil {
+			if len(names) == 0 {
+				return nil, err
+			}
+			return names, fmt.Errorf("walk of %s stopped at %s: %w", zone, cur, err)
+		}
+		if seen[next] || (next != zone && !strings.HasSuffix(next, "."+zone)) {
+			break
+		}
+		seen[next] = true
+		names = append(names, next)
+		cur = next
+	}
+	return names, nil
+}
+
+// wireName decodes an uncompressed domain name at the start of data, as
+// found in the next-domain field of NSEC record data.
+func wireName(data []byte) (string, error) {
+	var labels []string
+	for i := 0; i < len(data); {
+		n := int(data[i])
+		if n == 0 {
+			if len(labels) == 0 {
+				return ".", nil
+			}
+			return canonical(strings.Join(labels, ".")), nil
+		}
+		if n > 63 || i+1+n > len(data) {
+			return "", fmt.Errorf("invalid label at offset %d", i)
+		}
+		labels = append(labels, string(data[i+1:i+1+n]))
+		i += 1 + n
+	}
+	return "", fmt.Errorf("unterminated name")
+}
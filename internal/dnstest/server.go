@@ -0,0 +1,376 @@
+// Package dnstest provides a local DNS stand-in for tests of the native scanners.
+package dnstest
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// record is a single resource record held by the server.
+type record struct {
+	typ   dnsmessage.Type
+	value string
+}
+
+// typeNSEC is the NSEC record type, which dnsmessage does not define.
+const typeNSEC = dnsmessage.Type(47)
+
+// Server answers DNS queries over UDP and TCP from an in-memory record set.
+// It behaves like a recursive resolver for the records it holds: CNAME chains
+// are followed, wildcard owners such as "*.dev.example.com" are expanded and
+// unknown names yield NXDOMAIN. Over TCP it also serves zone transfers for
+// zones passed to AllowTransfer.
+type Server struct {
+	Addr string // host:port the server listens on, for both UDP and TCP
+
+	mu        sync.Mutex
+	records   map[string][]record
+	transfers map[string]bool
+	queries   int
+	conn      net.PacketConn
+	ln        net.Listener
+}
+
+// NewServer starts a server on a random loopback port.
+func NewServer() (*Server, error) {
+	var (
+		conn net.PacketConn
+		ln   net.Listener
+		err  error
+	)
+	// The TCP port must match the randomly chosen UDP one, which may be taken
+	for attempt := 0; attempt < 10; attempt++ {
+		conn, err = net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			return nil, err
+		}
+		ln, err = net.Listen("tcp", conn.LocalAddr().String())
+		if err == nil {
+			break
+		}
+		conn.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		Addr:      conn.LocalAddr().String(),
+		records:   make(map[string][]record),
+		transfers: make(map[string]bool),
+		conn:      conn,
+		ln:        ln,
+	}
+	go s.serve()
+	go s.serveTCP()
+	return s, nil
+}
+
+// AddA adds an A record for name.
+func (s *Server) AddA(name, ip string) {
+	s.add(name, dnsmessage.TypeA, ip)
+}
+
+// AddAAAA adds an AAAA record for name.
+func (s *Server) AddAAAA(name, ip string) {
+	s.add(name, dnsmessage.TypeAAAA, ip)
+}
+
+// AddCNAME points name at target.
+func (s *Server) AddCNAME(name, target string) {
+	s.add(name, dnsmessage.TypeCNAME, target)
+}
+
+// AddPTR adds a PTR record for ip pointing at name.
+func (s *Server) AddPTR(ip, name string) {
+	s.add(reverseName(net.ParseIP(ip)), dnsmessage.TypePTR, name)
+}
+
+// AddNS adds a nameserver for zone.
+func (s *Server) AddNS(zone, ns string) {
+	s.add(zone, dnsmessage.TypeNS, ns)
+}
+
+// AddNSEC adds an NSEC record for name pointing at next, the following owner
+// name in the zone. The last name in a zone points back at the apex.
+func (s *Server) AddNSEC(name, next string) {
+	s.add(name, typeNSEC, next)
+}
+
+// AllowTransfer makes the server answer AXFR requests for zone with every
+// record at or below it, between two synthesized SOA records.
+func (s *Server) AllowTransfer(zone string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.transfers[canonical(zone)] = true
+}
+
+// Queries returns the number of queries answered so far.
+func (s *Server) Queries() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.queries
+}
+
+// Close stops the server.
+func (s *Server) Close() {
+	s.conn.Close()
+	s.ln.Close()
+}
+
+func (s *Server) add(name string, typ dnsmessage.Type, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	name = canonical(name)
+	s.records[name] = append(s.records[name], record{typ: typ, value: value})
+}
+
+func (s *Server) serve() {
+	buf := make([]byte, 4096)
+	for {
+		n, addr, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+
+		var query dnsmessage.Message
+		if err := query.Unpack(buf[:n]); err != nil || len(query.Questions) == 0 {
+			continue
+		}
+
+		resp := s.respond(&query)
+		packed, err := resp.Pack()
+		if err != nil {
+			continue
+		}
+		s.conn.WriteTo(packed, addr)
+	}
+}
+
+func (s *Server) serveTCP() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.handleTCP(conn)
+	}
+}
+
+// handleTCP answers length-prefixed queries on conn until the client hangs up.
+func (s *Server) handleTCP(conn net.Conn) {
+	defer conn.Close()
+	for {
+		var hdr [2]byte
+		if _, err := io.ReadFull(conn, hdr[:]); err != nil {
+			return
+		}
+		buf := make([]byte, binary.BigEndian.Uint16(hdr[:]))
+		if _, err := io.ReadFull(conn, buf); err != nil {
+			return
+		}
+
+		var query dnsmessage.Message
+		if err := query.Unpack(buf); err != nil || len(query.Questions) == 0 {
+			return
+		}
+
+		var msgs []*dnsmessage.Message
+		if query.Questions[0].Type == dnsmessage.TypeAXFR {
+			msgs = s.transfer(&query)
+		} else {
+			msgs = []*dnsmessage.Message{s.respond(&query)}
+		}
+		for _, msg := range msgs {
+			packed, err := msg.Pack()
+			if err != nil {
+				return
+			}
+			out := make([]byte, 2+len(packed))
+			binary.BigEndian.PutUint16(out, uint16(len(packed)))
+			copy(out[2:], packed)
+			if _, err := conn.Write(out); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// transfer builds the messages of a zone transfer, or a single refusal when
+// the zone was not passed to AllowTransfer. The closing SOA is sent in a
+// message of its own, as real servers split large transfers.
+func (s *Server) transfer(query *dnsmessage.Message) []*dnsmessage.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.queries++
+
+	reply := func() *dnsmessage.Message {
+		return &dnsmessage.Message{
+			Header:    dnsmessage.Header{ID: query.ID, Response: true, Authoritative: true},
+			Questions: query.Questions,
+		}
+	}
+
+	zone := canonical(query.Questions[0].Name.String())
+	if !s.transfers[zone] {
+		resp := reply()
+		resp.RCode = dnsmessage.RCodeRefused
+		return []*dnsmessage.Message{resp}
+	}
+
+	var names []string
+	for name := range s.records {
+		if name == zone || strings.HasSuffix(name, "."+zone) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	soa := dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName(zone + "."), Class: dnsmessage.ClassINET, TTL: 60},
+		Body: &dnsmessage.SOAResource{
+			NS:     dnsmessage.MustNewName("ns." + zone + "."),
+			MBox:   dnsmessage.MustNewName("hostmaster." + zone + "."),
+			Serial: 1, Refresh: 3600, Retry: 600, Expire: 86400, MinTTL: 60,
+		},
+	}
+	first := reply()
+	first.Answers = append(first.Answers, soa)
+	for _, name := range names {
+		for _, r := range s.records[name] {
+			first.Answers = append(first.Answers, resource(name, r))
+		}
+	}
+	last := reply()
+	last.Answers = append(last.Answers, soa)
+	return []*dnsmessage.Message{first, last}
+}
+
+// respond builds the reply for a query.
+func (s *Server) respond(query *dnsmessage.Message) *dnsmessage.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.queries++
+
+	q := query.Questions[0]
+	resp := &dnsmessage.Message{
+		Header: dnsmessage.Header{
+			ID:                 query.ID,
+			Response:           true,
+			RecursionDesired:   query.RecursionDesired,
+			RecursionAvailable: true,
+		},
+		Questions: query.Questions,
+	}
+
+	name := canonical(q.Name.String())
+	for depth := 0; depth < 16; depth++ {
+		recs, ok := s.lookup(name)
+		if !ok {
+			resp.RCode = dnsmessage.RCodeNameError
+			break
+		}
+
+		var target string
+		for _, r := range recs {
+			if r.typ == dnsmessage.TypeCNAME && q.Type != dnsmessage.TypeCNAME {
+				target = canonical(r.value)
+			}
+		}
+		if target != "" {
+			resp.Answers = append(resp.Answers, resource(name, record{typ: dnsmessage.TypeCNAME, value: target}))
+			name = target
+			continue
+		}
+
+		for _, r := range recs {
+			if r.typ == q.Type {
+				resp.Answers = append(resp.Answers, resource(name, r))
+			}
+		}
+		break
+	}
+
+	return resp
+}
+
+// lookup returns the records for name, expanding wildcards at the closest encloser.
+func (s *Server) lookup(name string) ([]record, bool) {
+	if recs, ok := s.records[name]; ok {
+		return recs, true
+	}
+
+	parent := name
+	for {
+		i := strings.IndexByte(parent, '.')
+		if i < 0 {
+			return nil, false
+		}
+		parent = parent[i+1:]
+		if recs, ok := s.records["*."+parent]; ok {
+			return recs, true
+		}
+		if _, ok := s.records[parent]; ok {
+			return nil, false
+		}
+	}
+}
+
+// resource converts a record to a dnsmessage resource owned by name.
+func resource(name string, r record) dnsmessage.Resource {
+	hdr := dnsmessage.ResourceHeader{
+		Name:  dnsmessage.MustNewName(name + "."),
+		Class: dnsmessage.ClassINET,
+		TTL:   60,
+	}
+
+	switch r.typ {
+	case dnsmessage.TypeA:
+		var a [4]byte
+		copy(a[:], net.ParseIP(r.value).To4())
+		return dnsmessage.Resource{Header: hdr, Body: &dnsmessage.AResource{A: a}}
+	case dnsmessage.TypeAAAA:
+		var aaaa [16]byte
+		copy(aaaa[:], net.ParseIP(r.value).To16())
+		return dnsmessage.Resource{Header: hdr, Body: &dnsmessage.AAAAResource{AAAA: aaaa}}
+	case dnsmessage.TypePTR:
+		return dnsmessage.Resource{Header: hdr, Body: &dnsmessage.PTRResource{PTR: dnsmessage.MustNewName(canonical(r.value) + ".")}}
+	case dnsmessage.TypeNS:
+		return dnsmessage.Resource{Header: hdr, Body: &dnsmessage.NSResource{NS: dnsmessage.MustNewName(canonical(r.value) + ".")}}
+	case typeNSEC:
+		// Next domain name, uncompressed, followed by a type bitmap covering
+		// A and RRSIG
+		var data []byte
+		for _, label := range strings.Split(canonical(r.value), ".") {
+			data = append(data, byte(len(label)))
+			data = append(data, label...)
+		}
+		data = append(data, 0, 0, 6, 0x40, 0, 0, 0, 0, 0x02)
+		return dnsmessage.Resource{Header: hdr, Body: &dnsmessage.UnknownResource{Type: typeNSEC, Data: data}}
+	default:
+		return dnsmessage.Resource{Header: hdr, Body: &dnsmessage.CNAMEResource{CNAME: dnsmessage.MustNewName(canonical(r.value) + ".")}}
+	}
+}
+
+// reverseName returns the in-addr.arpa or ip6.arpa name of ip.
+func reverseName(ip net.IP) string {
+	if v4 := ip.To4(); v4 != nil {
+		return fmt.Sprintf("%d.%d.%d.%d.in-addr.arpa", v4[3], v4[2], v4[1], v4[0])
+	}
+	var labels []string
+	for i := len(ip) - 1; i >= 0; i-- {
+		labels = append(labels, fmt.Sprintf("%x", ip[i]&0x0f), fmt.Sprintf("%x", ip[i]>>4))
+	}
+	return strings.Join(labels, ".") + ".ip6.arpa"
+}
+
+func canonical(name string) string {
+	return strings.TrimSuffix(strings.ToLower(name), ".")
+}
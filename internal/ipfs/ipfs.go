@@ -4,7 +4,6 @@ package ipfs
 import (
 	"crypto/sha256"
 	"fmt"
-	"io"
 	"net/http"
 	"os"
 
@@ -39,23 +38,14 @@ func FetchShardToCache(cid, root string, c *cache.Cache) error {
 			continue
 		}
 		
-		// Write directly to cache file
-		cachePath := c.CachePath(root)
-		outFile, err := os.Create(cachePath)
-		if err != nil {
-			resp.Body.Close()
-			return fmt.Errorf("failed to create cache file: %w", err)
-		}
-		
-		_, err = io.Copy(outFile, resp.Body)
+		// Replace the cache file atomically, dropping the local log
+		err = c.ImportShard(root, resp.Body)
 		resp.Body.Close()
-		outFile.Close()
-		
 		if err != nil {
-			return fmt.Errorf("failed to write cache file: %w", err)
+			return err
 		}
 		
-		fmt.Fprintf(os.Stderr, "Successfully fetched shard to %s\n", cachePath)
+		fmt.Fprintf(os.Stderr, "Successfully fetched shard to %s\n", c.CachePath(root))
 		return nil
 	}
 	
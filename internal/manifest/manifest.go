@@ -6,8 +6,15 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
+
+	"github.com/amoz0x/nether/internal/util"
 )
 
+// lockTimeout is how long Update waits for another process holding the
+// manifest lock.
+const lockTimeout = 10 * time.Second
+
 // Manifest represents the mapping of domains to IPFS shards and gateway configuration.
 type Manifest struct {
 	Roots    map[string]RootEnt `json:"roots"`
@@ -113,25 +120,43 @@ func (m Manifest) CIDFor(root string) string {
 	return ""
 }
 
-// SaveLocal saves the manifest to the local file.
-func SaveLocal(m Manifest) error {
-	// Ensure directory exists
-	dir := home()
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return fmt.Errorf("failed to create .blink directory: %w", err)
+// Update loads the local manifest, applies fn and saves the result, holding
+// the manifest lock throughout so concurrent updates aren't lost. Nothing is
+// saved when fn returns an error. It is the only way to write the manifest.
+func Update(fn func(m *Manifest) error) error {
+	release, err := lock()
+	if err != nil {
+		return err
 	}
-	
-	// Marshal manifest
+	defer release()
+
+	m := LoadLocalOrDefault()
+	if err := fn(&m); err != nil {
+		return err
+	}
+	return save(m)
+}
+
+// lock takes the exclusive lock of the manifest, creating its directory.
+func lock() (func(), error) {
+	if err := os.MkdirAll(home(), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create .blink directory: %w", err)
+	}
+	release, err := util.Lock(path()+".lock", true, lockTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock manifest: %w", err)
+	}
+	return release, nil
+}
+
+// save replaces the manifest file atomically. The caller holds the lock.
+func save(m Manifest) error {
 	data, err := json.MarshalIndent(m, "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to marshal manifest: %w", err)
 	}
-	
-	// Write to file
-	manifestPath := path()
-	if err := os.WriteFile(manifestPath, data, 0644); err != nil {
+	if err := util.WriteFileAtomic(path(), data); err != nil {
 		return fmt.Errorf("failed to write manifest: %w", err)
 	}
-	
 	return nil
 }
@@ -0,0 +1,35 @@
+package manifest
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestUpdateKeepsConcurrentChanges(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			err := Update(func(m *Manifest) error {
+				m.Roots[fmt.Sprintf("example%d.com", i)] = RootEnt{ShardCID: fmt.Sprintf("cid%d", i)}
+				return nil
+			})
+			if err != nil {
+				t.Errorf("Failed to update manifest: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	m := LoadLocalOrDefault()
+	if len(m.Roots) != 10 {
+		t.Errorf("Expected 10 roots, got %v", m.Roots)
+	}
+	if cid := m.CIDFor("example3.com"); cid != "cid3" {
+		t.Errorf("Expected cid3, got %q", cid)
+	}
+}
@@ -3,84 +3,377 @@ package merge
 
 import (
 	"fmt"
+	"reflect"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/amoz0x/nether/internal/cache"
+	"github.com/amoz0x/nether/internal/scope"
+	"github.com/amoz0x/nether/internal/util"
 )
 
 // Row is an alias for cache.Row for convenience.
 type Row = cache.Row
 
+// Thresholds of consecutive missed scans after which a row changes status.
+const (
+	StaleAfter  = 2
+	RemoveAfter = 5
+)
+
+// KindHomograph is the finding kind recorded for hosts with labels that
+// imitate other names, see util.Homograph.
+const KindHomograph = "homograph"
+
 // Source bit constants for tracking discovery methods.
 const (
-	SourceSubfinder = 1
-	SourceCT        = 2
-	SourceDNSProof  = 4
-	SourceOther     = 8
+	SourceSubfinder   = 1
+	SourceCT          = 2
+	SourceDNSProof    = 4
+	SourceOther       = 8
+	SourceBrute       = 16
+	SourceAmass       = 32
+	SourceAssetfinder = 64
+	SourceFindomain   = 128
+	SourceTLS         = 256
+	SourcePermute     = 512
+	SourceAXFR        = 1024
+	SourceNSEC        = 2048
+	SourcePTR         = 4096
 )
 
+// sourceNames maps each source bit to its display name.
+var sourceNames = map[int]string{
+	SourceSubfinder:   "subfinder",
+	SourceCT:          "ct",
+	SourceDNSProof:    "dnsproof",
+	SourceOther:       "other",
+	SourceBrute:       "brute",
+	SourceAmass:       "amass",
+	SourceAssetfinder: "assetfinder",
+	SourceFindomain:   "findomain",
+	SourceTLS:         "tls",
+	SourcePermute:     "permute",
+	SourceAXFR:        "axfr",
+	SourceNSEC:        "nsec",
+	SourcePTR:         "ptr",
+}
+
+// SourceNames decodes a SrcBits value into source names, in bit order.
+func SourceNames(bits int) []string {
+	var names []string
+	for bit := 1; bit > 0 && bit <= bits; bit <<= 1 {
+		if bits&bit == 0 {
+			continue
+		}
+		if name, ok := sourceNames[bit]; ok {
+			names = append(names, name)
+		} else {
+			names = append(names, fmt.Sprintf("bit%d", bit))
+		}
+	}
+	return names
+}
+
+// MatchSources reports whether row was reported by any of the named sources,
+// comparing against both its upstream sources and its decoded source bits.
+func MatchSources(row Row, names []string) bool {
+	for _, name := range names {
+		for _, src := range row.Sources {
+			if strings.EqualFold(src, name) {
+				return true
+			}
+		}
+		for _, src := range SourceNames(row.SrcBits) {
+			if strings.EqualFold(src, name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Hit is a subdomain reported by one or more sources during a scan.
+type Hit struct {
+	Sub     string
+	SrcBits int
+	Sources []string // Upstream sources reported alongside the subdomain
+	Parent  string   // Sub-zone the scan ran against, when not the root itself
+}
+
 // MergeFound merges newly found subdomains with existing cache data.
 // Returns the slice of newly added rows (for delta tracking).
 func MergeFound(root string, found []string, c *cache.Cache, srcBit int) ([]Row, error) {
+	hits := make([]Hit, 0, len(found))
+	for _, sub := range found {
+		hits = append(hits, Hit{Sub: sub, SrcBits: srcBit})
+	}
+	res, err := MergeHits(root, hits, c)
+	return res.Added, err
+}
+
+// Result describes the outcome of a merge.
+type Result struct {
+	Added   []Row // Rows seen for the first time or again after removal (for delta tracking)
+	Touched []Row // Every row added or updated by the merge, sorted by subdomain
+	Stale   []Row // Rows that became stale
+	Removed []Row // Rows that became removed (for delta tracking)
+}
+
+// MergeHits merges hits from any number of sources with existing cache data
+// and appends the rows it added or updated to the cache log in a single
+// write. Invalid names, hosts outside root and hits outside the root's scope
+// are dropped. Cached rows are never deleted for being out of scope, as a
+// one-off --scope file would otherwise wipe them; output filters them
+// instead.
+func MergeHits(root string, hits []Hit, c *cache.Cache) (Result, error) {
 	now := time.Now().UTC().Format(time.RFC3339)
 	
-	// Load existing rows into a map
-	existing := make(map[string]Row)
-	err := c.IterRows(root, func(row Row) {
-		existing[row.Sub] = row
-	})
+	sc, err := scope.ForRoot(c, root)
+	if err != nil {
+		return Result{}, err
+	}
+	
+	// Validate hits first so only the cached rows they touch are kept
+	valid := make([]Hit, 0, len(hits))
+	wanted := make(map[string]bool, len(hits))
+	for _, hit := range hits {
+		sub, reason := util.CheckHost(hit.Sub, root)
+		if reason != "" || !sc.Allows(sub) {
+			continue
+		}
+		hit.Sub = sub
+		valid = append(valid, hit)
+		wanted[sub] = true
+	}
+	
+	l, err := c.Lock(root)
+	if err != nil {
+		return Result{}, err
+	}
+	defer l.Unlock()
+	
+	existing, err := l.Lookup(wanted)
 	if err != nil {
-		return nil, fmt.Errorf("failed to load existing rows: %w", err)
+		return Result{}, fmt.Errorf("failed to load existing rows: %w", err)
 	}
 	
 	// Track newly added subdomains
 	var added []Row
+	addedIdx := make(map[string]int)
 	
 	// Process found subdomains
-	for _, sub := range found {
-		if sub == "" {
-			continue
-		}
-		
-		if row, exists := existing[sub]; exists {
-			// Update existing row
+	for _, hit := range valid {
+		if row, exists := existing[hit.Sub]; exists {
+			// Update existing row; a removed host that reappears counts as added
+			if row.Status == cache.StatusRemoved {
+				addedIdx[hit.Sub] = len(added)
+				added = append(added, row)
+			}
+			row.Status = ""
+			row.Misses = 0
 			row.LastSeen = now
-			row.SrcBits |= srcBit
-			existing[sub] = row
+			row.SrcBits |= hit.SrcBits
+			row.Sources = mergeSources(row.Sources, hit.Sources)
+			existing[hit.Sub] = row
+			if i, ok := addedIdx[hit.Sub]; ok {
+				added[i] = row
+			}
 		} else {
 			// Create new row
 			newRow := Row{
-				Sub:       sub,
+				Sub:       hit.Sub,
 				FirstSeen: now,
 				LastSeen:  now,
-				SrcBits:   srcBit,
+				SrcBits:   hit.SrcBits,
+				Sources:   mergeSources(nil, hit.Sources),
+				Parent:    hit.Parent,
 			}
-			existing[sub] = newRow
+			if label, ok := util.Homograph(hit.Sub); ok {
+				newRow.Findings = []cache.Finding{{
+					Kind:       KindHomograph,
+					Evidence:   fmt.Sprintf("label %q mixes scripts or imitates Latin letters", label),
+					DetectedAt: now,
+				}}
+			}
+			existing[hit.Sub] = newRow
+			addedIdx[hit.Sub] = len(added)
 			added = append(added, newRow)
 		}
 	}
 	
-	// Convert map back to slice and sort
-	var allRows []Row
+	// Every row left in existing was touched by a hit
+	var res Result
 	for _, row := range existing {
-		allRows = append(allRows, row)
+		res.Touched = append(res.Touched, row)
 	}
-	sort.Slice(allRows, func(i, j int) bool {
-		return allRows[i].Sub < allRows[j].Sub
+	sort.Slice(res.Touched, func(i, j int) bool {
+		return res.Touched[i].Sub < res.Touched[j].Sub
 	})
 	
 	// Write back to cache
-	if err := c.WriteRows(root, allRows); err != nil {
-		return nil, fmt.Errorf("failed to write updated cache: %w", err)
+	if err := l.AppendRows(res.Touched); err != nil {
+		return Result{}, fmt.Errorf("failed to write updated cache: %w", err)
 	}
 	
 	// Write delta file if we have new entries
 	if len(added) > 0 {
-		if _, err := c.AppendDelta(root, added); err != nil {
-			return nil, fmt.Errorf("failed to write delta: %w", err)
+		if _, err := l.AppendDelta(added); err != nil {
+			return Result{}, fmt.Errorf("failed to write delta: %w", err)
 		}
 	}
 	
-	return added, nil
+	res.Added = added
+	return res, nil
+}
+
+// Sweep counts a missed scan for every row of root that was not seen by a
+// completed scan. Only rows reported by one of the sources in ranBits, or
+// with no recorded source, are counted, so a scan with a narrower source set
+// doesn't age hosts it could never have found. Rows become stale after
+// StaleAfter misses and removed after RemoveAfter; removals are written to a
+// delta file.
+func Sweep(root string, seen map[string]bool, ranBits int, c *cache.Cache) (Result, error) {
+	l, err := c.Lock(root)
+	if err != nil {
+		return Result{}, err
+	}
+	defer l.Unlock()
+	
+	rows, err := l.Rows()
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to load existing rows: %w", err)
+	}
+	
+	var res Result
+	var changed []Row
+	for _, row := range rows {
+		if seen[row.Sub] || row.Status == cache.StatusRemoved {
+			continue
+		}
+		if row.SrcBits != 0 && row.SrcBits&ranBits == 0 {
+			continue
+		}
+		
+		row.Misses++
+		switch {
+		case row.Misses >= RemoveAfter:
+			row.Status = cache.StatusRemoved
+			res.Removed = append(res.Removed, row)
+		case row.Misses >= StaleAfter && row.Status != cache.StatusStale:
+			row.Status = cache.StatusStale
+			res.Stale = append(res.Stale, row)
+		}
+		changed = append(changed, row)
+	}
+	
+	if len(changed) == 0 {
+		return res, nil
+	}
+	if err := l.AppendRows(changed); err != nil {
+		return Result{}, fmt.Errorf("failed to write updated cache: %w", err)
+	}
+	if len(res.Removed) > 0 {
+		if _, err := l.AppendDelta(res.Removed); err != nil {
+			return Result{}, fmt.Errorf("failed to write delta: %w", err)
+		}
+	}
+	return res, nil
+}
+
+// Update applies fn to every row of root and appends the rows it changed in
+// a single write. fn must replace rather than modify the slices and records
+// of a row for the change to be seen.
+func Update(root string, c *cache.Cache, fn func(row *Row)) error {
+	l, err := c.Lock(root)
+	if err != nil {
+		return err
+	}
+	defer l.Unlock()
+	
+	rows, err := l.Rows()
+	if err != nil {
+		return fmt.Errorf("failed to load existing rows: %w", err)
+	}
+	var changed []Row
+	for _, row := range rows {
+		before := row
+		fn(&row)
+		if !reflect.DeepEqual(before, row) {
+			changed = append(changed, row)
+		}
+	}
+	
+	if err := l.AppendRows(changed); err != nil {
+		return fmt.Errorf("failed to write updated cache: %w", err)
+	}
+	return nil
+}
+
+// SetRecords stores DNS records on the matching rows of root. Rows without
+// an entry in records keep their previous records.
+func SetRecords(root string, records map[string]cache.Records, c *cache.Cache) error {
+	if len(records) == 0 {
+		return nil
+	}
+	return Update(root, c, func(row *Row) {
+		if rec, ok := records[row.Sub]; ok {
+			row.DNS = &rec
+		}
+	})
+}
+
+// SetProbes stores HTTP probe results on the matching rows of root. Rows in
+// probes without any response have their previous results cleared.
+func SetProbes(root string, probes map[string][]cache.Probe, c *cache.Cache) error {
+	if len(probes) == 0 {
+		return nil
+	}
+	return Update(root, c, func(row *Row) {
+		if p, ok := probes[row.Sub]; ok {
+			row.HTTP = p
+		}
+	})
+}
+
+// SetFindings replaces the findings of the given kind on every checked row
+// of root with those in findings, so issues that were fixed are cleared.
+func SetFindings(root, kind string, checked map[string]bool, findings map[string][]cache.Finding, c *cache.Cache) error {
+	if len(checked) == 0 {
+		return nil
+	}
+	return Update(root, c, func(row *Row) {
+		if !checked[row.Sub] {
+			return
+		}
+		var kept []cache.Finding
+		for _, f := range row.Findings {
+			if f.Kind != kind {
+				kept = append(kept, f)
+			}
+		}
+		row.Findings = append(kept, findings[row.Sub]...)
+	})
+}
+
+// mergeSources returns the sorted union of two source name lists.
+func mergeSources(have, add []string) []string {
+	if len(add) == 0 {
+		return have
+	}
+
+	seen := make(map[string]bool, len(have)+len(add))
+	var out []string
+	for _, list := range [][]string{have, add} {
+		for _, src := range list {
+			if src == "" || seen[src] {
+				continue
+			}
+			seen[src] = true
+			out = append(out, src)
+		}
+	}
+	sort.Strings(out)
+	return out
 }
@@ -0,0 +1,324 @@
+package merge
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/amoz0x/nether/internal/cache"
+)
+
+func newTestCache(t testing.TB) *cache.Cache {
+	tmpDir, err := os.MkdirTemp("", "blink-merge-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(tmpDir) })
+
+	for _, dir := range []string{"cache", "deltas"} {
+		if err := os.MkdirAll(filepath.Join(tmpDir, dir), 0755); err != nil {
+			t.Fatalf("Failed to create %s dir: %v", dir, err)
+		}
+	}
+	return &cache.Cache{Base: tmpDir}
+}
+
+func TestMergeHitsCarriesSources(t *testing.T) {
+	c := newTestCache(t)
+
+	res, err := MergeHits("example.com", []Hit{
+		{Sub: "api.example.com", SrcBits: SourceSubfinder, Sources: []string{"crtsh"}},
+		{Sub: "www.example.com", SrcBits: SourceBrute},
+	}, c)
+	if err != nil {
+		t.Fatalf("MergeHits failed: %v", err)
+	}
+	if len(res.Added) != 2 {
+		t.Fatalf("Expected 2 added rows, got %d", len(res.Added))
+	}
+
+	// A second scan adds another upstream source to an existing row
+	res, err = MergeHits("example.com", []Hit{
+		{Sub: "api.example.com", SrcBits: SourceSubfinder, Sources: []string{"virustotal", "crtsh"}},
+	}, c)
+	if err != nil {
+		t.Fatalf("MergeHits failed: %v", err)
+	}
+	if len(res.Added) != 0 {
+		t.Fatalf("Expected no added rows, got %d", len(res.Added))
+	}
+	if len(res.Touched) != 1 || res.Touched[0].Sub != "api.example.com" {
+		t.Fatalf("Expected only api.example.com touched, got %v", res.Touched)
+	}
+
+	rows, err := c.Rows("example.com")
+	if err != nil {
+		t.Fatalf("Failed to read rows: %v", err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("Expected 2 rows, got %d", len(rows))
+	}
+
+	if want := []string{"crtsh", "virustotal"}; !reflect.DeepEqual(rows[0].Sources, want) {
+		t.Errorf("Expected sources %v, got %v", want, rows[0].Sources)
+	}
+	if rows[1].Sources != nil {
+		t.Errorf("Expected no upstream sources for brute row, got %v", rows[1].Sources)
+	}
+
+	if !MatchSources(rows[0], []string{"CRTSH"}) {
+		t.Errorf("Expected api row to match crtsh")
+	}
+	if !MatchSources(rows[1], []string{"brute"}) {
+		t.Errorf("Expected www row to match brute via its source bit")
+	}
+	if MatchSources(rows[1], []string{"crtsh"}) {
+		t.Errorf("Expected www row not to match crtsh")
+	}
+}
+
+func TestSourceNames(t *testing.T) {
+	got := SourceNames(SourceSubfinder | SourceBrute | 1<<20)
+	want := []string{"subfinder", "brute", "bit1048576"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
+
+func TestSweepAgesMissingRows(t *testing.T) {
+	c := newTestCache(t)
+
+	if _, err := MergeHits("example.com", []Hit{
+		{Sub: "api.example.com", SrcBits: SourceSubfinder},
+		{Sub: "old.example.com", SrcBits: SourceSubfinder},
+		{Sub: "www.example.com", SrcBits: SourceBrute},
+	}, c); err != nil {
+		t.Fatalf("MergeHits failed: %v", err)
+	}
+
+	seen := map[string]bool{"api.example.com": true}
+	status := func() map[string]string {
+		rows, err := c.Rows("example.com")
+		if err != nil {
+			t.Fatalf("Failed to read rows: %v", err)
+		}
+		m := make(map[string]string)
+		for _, row := range rows {
+			m[row.Sub] = row.State()
+		}
+		return m
+	}
+
+	// Subfinder-only scans never age the brute-only host
+	var removed []Row
+	for i := 0; i < RemoveAfter; i++ {
+		res, err := Sweep("example.com", seen, SourceSubfinder, c)
+		if err != nil {
+			t.Fatalf("Sweep failed: %v", err)
+		}
+		if i+1 == StaleAfter && (len(res.Stale) != 1 || status()["old.example.com"] != cache.StatusStale) {
+			t.Fatalf("Expected old.example.com to turn stale after %d misses, got %v", StaleAfter, status())
+		}
+		removed = append(removed, res.Removed...)
+	}
+
+	want := map[string]string{
+		"api.example.com": cache.StatusActive,
+		"old.example.com": cache.StatusRemoved,
+		"www.example.com": cache.StatusActive,
+	}
+	if got := status(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Expected %v, got %v", want, got)
+	}
+	if len(removed) != 1 || removed[0].Sub != "old.example.com" {
+		t.Fatalf("Expected old.example.com to be reported removed once, got %v", removed)
+	}
+
+	// A removed host that reappears is active again and counts as added
+	res, err := MergeHits("example.com", []Hit{{Sub: "old.example.com", SrcBits: SourceSubfinder}}, c)
+	if err != nil {
+		t.Fatalf("MergeHits failed: %v", err)
+	}
+	if len(res.Added) != 1 || res.Touched[0].State() != cache.StatusActive || res.Touched[0].Misses != 0 {
+		t.Errorf("Expected revived row to be added and active, got %+v", res)
+	}
+}
+
+func TestSetFindingsReplacesKind(t *testing.T) {
+	c := newTestCache(t)
+
+	if _, err := MergeFound("example.com", []string{"a.example.com", "b.example.com"}, c, SourceSubfinder); err != nil {
+		t.Fatalf("MergeFound failed: %v", err)
+	}
+
+	other := cache.Finding{Kind: "other", Evidence: "kept"}
+	old := cache.Finding{Kind: "takeover", Evidence: "fixed since"}
+	if err := SetFindings("example.com", "takeover", map[string]bool{"a.example.com": true, "b.example.com": true},
+		map[string][]cache.Finding{"a.example.com": {other, old}, "b.example.com": {old}}, c); err != nil {
+		t.Fatalf("SetFindings failed: %v", err)
+	}
+
+	// A later check only finds b; a's takeover finding is cleared but other kinds stay
+	fresh := cache.Finding{Kind: "takeover", Evidence: "still dangling"}
+	if err := SetFindings("example.com", "takeover", map[string]bool{"a.example.com": true, "b.example.com": true},
+		map[string][]cache.Finding{"b.example.com": {fresh}}, c); err != nil {
+		t.Fatalf("SetFindings failed: %v", err)
+	}
+
+	rows, err := c.Rows("example.com")
+	if err != nil {
+		t.Fatalf("Failed to read rows: %v", err)
+	}
+	if want := []cache.Finding{other}; !reflect.DeepEqual(rows[0].Findings, want) {
+		t.Errorf("Expected %v for a, got %v", want, rows[0].Findings)
+	}
+	if want := []cache.Finding{fresh}; !reflect.DeepEqual(rows[1].Findings, want) {
+		t.Errorf("Expected %v for b, got %v", want, rows[1].Findings)
+	}
+}
+
+func TestMergeHitsEnforcesScope(t *testing.T) {
+	c := newTestCache(t)
+
+	if _, err := MergeFound("example.com", []string{"status.example.com", "www.example.com"}, c, SourceSubfinder); err != nil {
+		t.Fatalf("MergeFound failed: %v", err)
+	}
+
+	// Excluding a host later keeps it from being merged again
+	if err := os.MkdirAll(filepath.Join(c.Base, "scopes"), 0755); err != nil {
+		t.Fatalf("Failed to create scopes dir: %v", err)
+	}
+	if err := os.WriteFile(c.ScopePath("example.com"), []byte("*.example.com\n!status.example.com\n!192.0.2.0/24\n"), 0644); err != nil {
+		t.Fatalf("Failed to write scope file: %v", err)
+	}
+
+	added, err := MergeFound("example.com", []string{"status.example.com", "api.example.com", "api.example.net"}, c, SourceSubfinder)
+	if err != nil {
+		t.Fatalf("MergeFound failed: %v", err)
+	}
+	if len(added) != 1 || added[0].Sub != "api.example.com" {
+		t.Fatalf("Expected only api.example.com added, got %v", added)
+	}
+
+	// Out-of-scope rows already cached are kept; output filters them
+	if err := SetRecords("example.com", map[string]cache.Records{"www.example.com": {A: []string{"192.0.2.5"}}}, c); err != nil {
+		t.Fatalf("SetRecords failed: %v", err)
+	}
+
+	subs, err := c.List("example.com")
+	if err != nil {
+		t.Fatalf("Failed to list rows: %v", err)
+	}
+	if want := []string{"api.example.com", "status.example.com", "www.example.com"}; !reflect.DeepEqual(subs, want) {
+		t.Errorf("Expected %v, got %v", want, subs)
+	}
+}
+
+func TestMergeHitsStoresPunycode(t *testing.T) {
+	c := newTestCache(t)
+
+	added, err := MergeFound("example.com", []string{"Bücher.example.com", "xn--bcher-kva.example.com", "аpple.example.com"}, c, SourceSubfinder)
+	if err != nil {
+		t.Fatalf("MergeFound failed: %v", err)
+	}
+	if len(added) != 2 {
+		t.Fatalf("Expected both spellings to merge into one row, got %v", added)
+	}
+
+	rows := make(map[string]Row)
+	for _, row := range added {
+		rows[row.Sub] = row
+	}
+	if row, ok := rows["xn--bcher-kva.example.com"]; !ok || len(row.Findings) != 0 {
+		t.Errorf("Expected xn--bcher-kva.example.com without findings, got %v", added)
+	}
+	row, ok := rows["xn--pple-43d.example.com"]
+	if !ok || len(row.Findings) != 1 || row.Findings[0].Kind != KindHomograph {
+		t.Errorf("Expected a homograph finding on xn--pple-43d.example.com, got %v", added)
+	}
+}
+
+func TestConcurrentUpdatesDontLoseWrites(t *testing.T) {
+	c := newTestCache(t)
+	if _, err := MergeFound("example.com", []string{"api.example.com"}, c, 0); err != nil {
+		t.Fatalf("MergeFound failed: %v", err)
+	}
+
+	// Each update reads the row and writes it back; without the root lock
+	// concurrent writers would overwrite each other's increments
+	const writers = 20
+	var wg sync.WaitGroup
+	errs := make(chan error, writers)
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- Update("example.com", c, func(row *Row) { row.Misses++ })
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("Update failed: %v", err)
+		}
+	}
+
+	rows, err := c.Rows("example.com")
+	if err != nil {
+		t.Fatalf("Failed to read rows: %v", err)
+	}
+	if len(rows) != 1 || rows[0].Misses != writers {
+		t.Errorf("Expected %d misses, got %v", writers, rows)
+	}
+}
+
+// seedRows writes n rows to the shard of example.com.
+func seedRows(t testing.TB, c *cache.Cache, n int) {
+	rows := make([]Row, n)
+	for i := range rows {
+		rows[i] = Row{Sub: fmt.Sprintf("host%06d.example.com", i), FirstSeen: "2024-01-01T00:00:00Z", LastSeen: "2024-01-01T00:00:00Z", SrcBits: SourceSubfinder}
+	}
+	if err := c.WriteRows("example.com", rows); err != nil {
+		t.Fatalf("Failed to write rows: %v", err)
+	}
+}
+
+func TestMergeHitsCostIndependentOfCacheSize(t *testing.T) {
+	hits := []Hit{{Sub: "host000007.example.com", SrcBits: SourceBrute}, {Sub: "new.example.com", SrcBits: SourceBrute}}
+	allocs := func(n int) float64 {
+		c := newTestCache(t)
+		seedRows(t, c, n)
+		return testing.AllocsPerRun(5, func() {
+			if _, err := MergeHits("example.com", hits, c); err != nil {
+				t.Fatalf("MergeHits failed: %v", err)
+			}
+		})
+	}
+
+	// Only the hit rows are decoded, so a 50x larger cache allocates about the same
+	small, large := allocs(1000), allocs(50000)
+	if large > small*1.5 {
+		t.Errorf("Expected merge allocations independent of cache size, got %.0f for 1000 rows and %.0f for 50000", small, large)
+	}
+}
+
+func BenchmarkMergeHits(b *testing.B) {
+	for _, n := range []int{1000, 10000, 100000} {
+		b.Run(fmt.Sprintf("rows=%d", n), func(b *testing.B) {
+			c := newTestCache(b)
+			seedRows(b, c, n)
+			hits := []Hit{{Sub: "host000007.example.com", SrcBits: SourceBrute}}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := MergeHits("example.com", hits, c); err != nil {
+					b.Fatalf("MergeHits failed: %v", err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,289 @@
+// Package output renders cached subdomain rows in the supported output formats.
+package output
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/amoz0x/nether/internal/cache"
+	"github.com/amoz0x/nether/internal/merge"
+	"github.com/amoz0x/nether/internal/util"
+)
+
+// Formats lists the supported output formats.
+var Formats = []string{"text", "json", "jsonl", "csv"}
+
+// Options selects how rows are rendered.
+type Options struct {
+	Format  string
+	Full    bool // Emit complete cache rows in json and jsonl output
+	Probed  bool // Include HTTP probe results in text and json output
+	Records bool // Include DNS records in text output
+	Unicode bool // Display punycode subdomains in their Unicode form
+}
+
+// Valid reports whether format is a supported output format.
+func Valid(format string) bool {
+	for _, f := range Formats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// Streamable reports whether format can be written one row at a time as
+// results arrive.
+func Streamable(format string) bool {
+	return format == "text" || format == "jsonl"
+}
+
+// Write renders rows to w in the format selected by opts.
+func Write(w io.Writer, opts Options, rows []cache.Tagged) error {
+	if opts.Unicode {
+		rows = unicodeRows(rows)
+	}
+
+	switch opts.Format {
+	case "text":
+		if opts.Probed {
+			return ProbeText(w, rows)
+		}
+		if opts.Records {
+			return RecordsText(w, rows)
+		}
+		return Text(w, rows)
+	case "json":
+		return JSON(w, rows, opts)
+	case "jsonl":
+		return JSONL(w, rows, opts)
+	case "csv":
+		return CSV(w, rows)
+	default:
+		return fmt.Errorf("unknown output format %q", opts.Format)
+	}
+}
+
+// WriteRow renders a single row in a streamable format.
+func WriteRow(w io.Writer, opts Options, row cache.Tagged) error {
+	if !Streamable(opts.Format) {
+		return fmt.Errorf("output format %q cannot be streamed", opts.Format)
+	}
+	return Write(w, opts, []cache.Tagged{row})
+}
+
+// Text prints one subdomain per line.
+func Text(w io.Writer, rows []cache.Tagged) error {
+	for _, row := range rows {
+		if _, err := fmt.Fprintln(w, row.Sub); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ProbeText prints one line per probed URL with its status, title and server.
+func ProbeText(w io.Writer, rows []cache.Tagged) error {
+	for _, row := range rows {
+		for _, p := range row.HTTP {
+			line := fmt.Sprintf("%s [%d]", p.URL, p.Status)
+			if p.Title != "" {
+				line += fmt.Sprintf(" [%s]", p.Title)
+			}
+			if p.Server != "" {
+				line += fmt.Sprintf(" [%s]", p.Server)
+			}
+			if p.FinalURL != "" {
+				line += " -> " + p.FinalURL
+			}
+			if _, err := fmt.Fprintln(w, line); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// RecordsText prints one line per subdomain with its CNAME chain and
+// addresses, or NXDOMAIN. Unresolved subdomains are printed alone.
+func RecordsText(w io.Writer, rows []cache.Tagged) error {
+	for _, row := range rows {
+		line := row.Sub
+		if dns := row.DNS; dns != nil {
+			if dns.NXDomain {
+				line += " [NXDOMAIN]"
+			}
+			for _, rr := range []struct {
+				kind   string
+				values []string
+			}{{"CNAME", dns.CNAME}, {"A", dns.A}, {"AAAA", dns.AAAA}} {
+				if len(rr.values) > 0 {
+					line += fmt.Sprintf(" [%s %s]", rr.kind, strings.Join(rr.values, " "))
+				}
+			}
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// jsonEntry is the JSON output form of a row.
+type jsonEntry struct {
+	Root    string        `json:"root"`
+	Sub     string        `json:"sub"`
+	Sources []string      `json:"sources"`
+	HTTP    []cache.Probe `json:"http,omitempty"`
+}
+
+// fullEntry is the JSON output form of a complete cache row.
+type fullEntry struct {
+	Root string `json:"root"`
+	cache.Row
+	Status      string   `json:"status"`       // Always present, unlike in the cache
+	SourceNames []string `json:"source_names"` // Decoded SrcBits
+}
+
+// entry returns the JSON output form of row.
+func entry(row cache.Tagged, opts Options) interface{} {
+	if opts.Full {
+		e := fullEntry{Root: row.Root, Row: row.Row, Status: row.State(), SourceNames: merge.SourceNames(row.SrcBits)}
+		if e.SourceNames == nil {
+			e.SourceNames = []string{}
+		}
+		return e
+	}
+
+	e := jsonEntry{Root: row.Root, Sub: row.Sub, Sources: row.Sources}
+	if opts.Probed {
+		e.HTTP = row.HTTP
+	}
+	if e.Sources == nil {
+		e.Sources = []string{}
+	}
+	return e
+}
+
+// JSON prints subdomains with their root and upstream sources as a JSON
+// array. With opts.Full set, each element is the complete cache row.
+func JSON(w io.Writer, rows []cache.Tagged, opts Options) error {
+	entries := make([]interface{}, len(rows))
+	for i, row := range rows {
+		entries[i] = entry(row, opts)
+	}
+
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal JSON: %w", err)
+	}
+	_, err = fmt.Fprintln(w, string(data))
+	return err
+}
+
+// JSONL prints one JSON object per line, in the same form as JSON.
+func JSONL(w io.Writer, rows []cache.Tagged, opts Options) error {
+	enc := json.NewEncoder(w)
+	for _, row := range rows {
+		if err := enc.Encode(entry(row, opts)); err != nil {
+			return fmt.Errorf("failed to marshal JSON: %w", err)
+		}
+	}
+	return nil
+}
+
+// csvHeader is the column layout of CSV output.
+var csvHeader = []string{"sub", "root", "first_seen", "last_seen", "sources", "status", "records", "resolved_at", "http"}
+
+// CSV prints rows as RFC 4180 CSV with a header line. The sources column
+// lists both scanner names and upstream sources, and the records column the
+// CNAME chain followed by the addresses and the http column "status url"
+// for each probed URL, each separated by semicolons.
+func CSV(w io.Writer, rows []cache.Tagged) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		record := []string{
+			row.Sub,
+			row.Root,
+			row.FirstSeen,
+			row.LastSeen,
+			strings.Join(allSources(row.Row), ";"),
+			row.State(),
+			strings.Join(records(row.Row), ";"),
+			resolvedAt(row.Row),
+			strings.Join(probes(row.Row), ";"),
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// unicodeRows returns copies of rows with subdomains decoded from punycode.
+// The cache always holds the ASCII form.
+func unicodeRows(rows []cache.Tagged) []cache.Tagged {
+	out := make([]cache.Tagged, len(rows))
+	for i, row := range rows {
+		row.Sub = util.ToUnicode(row.Sub)
+		out[i] = row
+	}
+	return out
+}
+
+// records returns the CNAME chain and addresses of a resolved row.
+func records(row cache.Row) []string {
+	if row.DNS == nil {
+		return nil
+	}
+	var out []string
+	out = append(out, row.DNS.CNAME...)
+	out = append(out, row.DNS.A...)
+	return append(out, row.DNS.AAAA...)
+}
+
+// resolvedAt returns when row was last resolved, or "" if never.
+func resolvedAt(row cache.Row) string {
+	if row.DNS == nil {
+		return ""
+	}
+	return row.DNS.ResolvedAt
+}
+
+// probes returns the status and URL of each probe of row.
+func probes(row cache.Row) []string {
+	var out []string
+	for _, p := range row.HTTP {
+		out = append(out, fmt.Sprintf("%d %s", p.Status, p.URL))
+	}
+	return out
+}
+
+// allSources returns the decoded source bits followed by upstream sources.
+func allSources(row cache.Row) []string {
+	names := merge.SourceNames(row.SrcBits)
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		seen[name] = true
+	}
+
+	upstream := append([]string(nil), row.Sources...)
+	sort.Strings(upstream)
+	for _, src := range upstream {
+		if !seen[src] {
+			seen[src] = true
+			names = append(names, src)
+		}
+	}
+	return names
+}
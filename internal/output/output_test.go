@@ -0,0 +1,148 @@
+package output
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/amoz0x/nether/internal/cache"
+	"github.com/amoz0x/nether/internal/merge"
+)
+
+func TestCSVRoundTrip(t *testing.T) {
+	rows := []cache.Tagged{
+		{Root: "example.com", Row: cache.Row{
+			Sub:       "api.example.com",
+			FirstSeen: "2025-01-01T00:00:00Z",
+			LastSeen:  "2025-02-01T00:00:00Z",
+			SrcBits:   merge.SourceSubfinder | merge.SourceBrute,
+			Sources:   []string{"virustotal", "crtsh"},
+			DNS: &cache.Records{
+				A:          []string{"192.0.2.10"},
+				AAAA:       []string{"2001:db8::10"},
+				CNAME:      []string{"edge.example.net"},
+				ResolvedAt: "2025-02-01T00:00:05Z",
+			},
+			HTTP: []cache.Probe{
+				{URL: "https://api.example.com/", Status: 200},
+				{URL: "http://api.example.com/", Status: 404},
+			},
+		}},
+		// Network rows only carry a hostname; a quote in a source must be escaped
+		{Root: "example.com", Row: cache.Row{Sub: "www.example.com", Sources: []string{`odd,"source"`}, Status: cache.StatusStale}},
+	}
+
+	var buf bytes.Buffer
+	if err := CSV(&buf, rows); err != nil {
+		t.Fatalf("CSV failed: %v", err)
+	}
+
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("Output is not valid CSV: %v", err)
+	}
+
+	expected := [][]string{
+		{"sub", "root", "first_seen", "last_seen", "sources", "status", "records", "resolved_at", "http"},
+		{"api.example.com", "example.com", "2025-01-01T00:00:00Z", "2025-02-01T00:00:00Z", "subfinder;brute;crtsh;virustotal", "active", "edge.example.net;192.0.2.10;2001:db8::10", "2025-02-01T00:00:05Z", "200 https://api.example.com/;404 http://api.example.com/"},
+		{"www.example.com", "example.com", "", "", `odd,"source"`, "stale", "", "", ""},
+	}
+	if !reflect.DeepEqual(records, expected) {
+		t.Errorf("Expected %v, got %v", expected, records)
+	}
+}
+
+func TestWriteRejectsUnknownFormat(t *testing.T) {
+	if Valid("xml") {
+		t.Errorf("Expected xml to be invalid")
+	}
+	if err := Write(&bytes.Buffer{}, Options{Format: "xml"}, nil); err == nil {
+		t.Errorf("Expected error for unknown format")
+	}
+}
+
+func TestJSONLFull(t *testing.T) {
+	rows := []cache.Tagged{
+		{Root: "example.com", Row: cache.Row{
+			Sub:       "api.example.com",
+			FirstSeen: "2025-01-01T00:00:00Z",
+			LastSeen:  "2025-02-01T00:00:00Z",
+			SrcBits:   merge.SourceSubfinder | merge.SourceBrute,
+			Sources:   []string{"crtsh"},
+		}},
+		{Root: "example.com", Row: cache.Row{Sub: "www.example.com"}},
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, Options{Format: "jsonl", Full: true}, rows); err != nil {
+		t.Fatalf("JSONL failed: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 lines, got %d: %q", len(lines), buf.String())
+	}
+
+	var got struct {
+		Root        string   `json:"root"`
+		Sub         string   `json:"sub"`
+		FirstSeen   string   `json:"first_seen"`
+		LastSeen    string   `json:"last_seen"`
+		SrcBits     int      `json:"src_bits"`
+		Sources     []string `json:"sources"`
+		SourceNames []string `json:"source_names"`
+	}
+	if err := json.Unmarshal([]byte(lines[0]), &got); err != nil {
+		t.Fatalf("Line is not valid JSON: %v", err)
+	}
+	if got.Root != "example.com" || got.FirstSeen != "2025-01-01T00:00:00Z" || got.LastSeen != "2025-02-01T00:00:00Z" {
+		t.Errorf("Expected root and timestamps to be kept, got %+v", got)
+	}
+	if want := []string{"subfinder", "brute"}; !reflect.DeepEqual(got.SourceNames, want) {
+		t.Errorf("Expected source names %v, got %v", want, got.SourceNames)
+	}
+	if !strings.Contains(lines[1], `"source_names":[]`) {
+		t.Errorf("Expected empty source_names array, got %s", lines[1])
+	}
+}
+
+func TestWriteUnicode(t *testing.T) {
+	rows := []cache.Tagged{{Root: "example.com", Row: cache.Row{Sub: "xn--bcher-kva.example.com"}}}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, Options{Format: "text", Unicode: true}, rows); err != nil {
+		t.Fatalf("Text failed: %v", err)
+	}
+	if got := strings.TrimSpace(buf.String()); got != "bücher.example.com" {
+		t.Errorf("Expected bücher.example.com, got %q", got)
+	}
+	if rows[0].Sub != "xn--bcher-kva.example.com" {
+		t.Errorf("Expected rows to be left in punycode, got %q", rows[0].Sub)
+	}
+}
+
+func TestRecordsText(t *testing.T) {
+	rows := []cache.Tagged{
+		{Root: "example.com", Row: cache.Row{Sub: "www.example.com", DNS: &cache.Records{
+			A:     []string{"192.0.2.1", "192.0.2.2"},
+			AAAA:  []string{"2001:db8::1"},
+			CNAME: []string{"edge.example.net"},
+		}}},
+		{Root: "example.com", Row: cache.Row{Sub: "gone.example.com", DNS: &cache.Records{NXDomain: true}}},
+		{Root: "example.com", Row: cache.Row{Sub: "new.example.com"}},
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, Options{Format: "text", Records: true}, rows); err != nil {
+		t.Fatalf("Text failed: %v", err)
+	}
+	want := "www.example.com [CNAME edge.example.net] [A 192.0.2.1 192.0.2.2] [AAAA 2001:db8::1]\n" +
+		"gone.example.com [NXDOMAIN]\n" +
+		"new.example.com\n"
+	if buf.String() != want {
+		t.Errorf("Expected %q, got %q", want, buf.String())
+	}
+}
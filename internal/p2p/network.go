@@ -6,10 +6,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"sort"
 	"time"
 
 	"github.com/amoz0x/nether/internal/cache"
 	"github.com/amoz0x/nether/internal/ipfs"
+	"github.com/amoz0x/nether/internal/scope"
+	"github.com/amoz0x/nether/internal/util"
 )
 
 // NetworkDB represents the decentralized subdomain database
@@ -49,28 +52,53 @@ func NewNetworkDB(localCache *cache.Cache) *NetworkDB {
 	}
 }
 
-// QueryDomain attempts to get subdomain data from the decentralized network
+// QueryDomain attempts to get subdomain data from the decentralized network.
+// Subdomains outside the domain's scope are left out. Subdomains found on the
+// network are written to the local cache.
 func (n *NetworkDB) QueryDomain(domain string) ([]string, error) {
+	sc, err := scope.ForRoot(n.localCache, domain)
+	if err != nil {
+		return nil, err
+	}
+
 	// Strategy 1: Check local cache first (instant)
-	if subs, err := n.localCache.List(domain); err == nil && len(subs) > 0 {
-		log.Printf("Found %d subdomains in local cache for %s", len(subs), domain)
-		return subs, nil
+	if subs, err := n.localCache.List(domain); err == nil {
+		if subs = sc.Filter(subs); len(subs) > 0 {
+			log.Printf("Found %d subdomains in local cache for %s", len(subs), domain)
+			return subs, nil
+		}
 	}
 
 	// Strategy 2: Query IPFS network for shared data
-	if subs, err := n.queryIPFSNetwork(domain); err == nil && len(subs) > 0 {
-		log.Printf("Found %d subdomains in IPFS network for %s", len(subs), domain)
-		// Cache locally for future instant access
-		n.cacheFromNetwork(domain, subs)
-		return subs, nil
+	if rows, err := n.queryIPFSNetwork(domain); err == nil {
+		if rows = sc.FilterRows(rows); len(rows) > 0 {
+			log.Printf("Found %d subdomains in IPFS network for %s", len(rows), domain)
+			// Cache locally for future instant access
+			if err := n.cacheFromNetwork(domain, rows); err != nil {
+				return nil, fmt.Errorf("failed to cache network data for %s: %v", domain, err)
+			}
+			subs := make([]string, len(rows))
+			for i, row := range rows {
+				subs[i] = row.Sub
+			}
+			return subs, nil
+		}
 	}
 
 	// Strategy 3: No data found in network
 	return nil, fmt.Errorf("no subdomain data found for %s in local cache or IPFS network", domain)
 }
 
-// PublishDomain publishes new subdomain data to the IPFS network
+// PublishDomain publishes new subdomain data to the IPFS network. Only the
+// discovery fields of active rows inside the domain's scope are shared, see
+// publicRows.
 func (n *NetworkDB) PublishDomain(domain string, subdomains []cache.Row) (string, error) {
+	sc, err := scope.ForRoot(n.localCache, domain)
+	if err != nil {
+		return "", err
+	}
+	subdomains = publicRows(sc.FilterRows(subdomains))
+
 	record := DomainRecord{
 		Domain:       domain,
 		Subdomains:   subdomains,
@@ -111,8 +139,28 @@ func (n *NetworkDB) PublishDomain(domain string, subdomains []cache.Row) (string
 	return hash, nil
 }
 
+// publicRows returns the active rows among rows, stripped down to what was
+// discovered and when. Resolution, probe and check results stay local: they
+// describe the targets' infrastructure and weaknesses.
+func publicRows(rows []cache.Row) []cache.Row {
+	public := make([]cache.Row, 0, len(rows))
+	for _, row := range rows {
+		if row.State() != cache.StatusActive {
+			continue
+		}
+		public = append(public, cache.Row{
+			Sub:       row.Sub,
+			FirstSeen: row.FirstSeen,
+			LastSeen:  row.LastSeen,
+			SrcBits:   row.SrcBits,
+			Sources:   row.Sources,
+		})
+	}
+	return public
+}
+
 // queryIPFSNetwork searches the IPFS network for domain data
-func (n *NetworkDB) queryIPFSNetwork(domain string) ([]string, error) {
+func (n *NetworkDB) queryIPFSNetwork(domain string) ([]cache.Row, error) {
 	// Step 1: Get global index to find latest hash for domain
 	index, err := n.getGlobalIndex()
 	if err != nil {
@@ -130,13 +178,7 @@ func (n *NetworkDB) queryIPFSNetwork(domain string) ([]string, error) {
 		return nil, fmt.Errorf("failed to fetch domain record: %v", err)
 	}
 
-	// Step 3: Extract subdomain list
-	subdomains := make([]string, len(record.Subdomains))
-	for i, row := range record.Subdomains {
-		subdomains[i] = row.Sub
-	}
-
-	return subdomains, nil
+	return record.Subdomains, nil
 }
 
 // getGlobalIndex retrieves the current global domain index from IPFS
@@ -212,23 +254,62 @@ func (n *NetworkDB) fetchDomainRecord(hash string) (*DomainRecord, error) {
 }
 
 // cacheFromNetwork stores network data in local cache
-func (n *NetworkDB) cacheFromNetwork(domain string, subdomains []string) error {
+func (n *NetworkDB) cacheFromNetwork(domain string, subdomains []cache.Row) error {
 	// Convert to cache format and store locally
-	rows := make([]cache.Row, len(subdomains))
-	now := time.Now().Format(time.RFC3339)
+	rows := make([]cache.Row, 0, len(subdomains))
+	now := time.Now().UTC()
 	
-	for i, sub := range subdomains {
-		rows[i] = cache.Row{
-			Sub:       sub,
-			FirstSeen: now,
-			LastSeen:  now,
-			SrcBits:   2, // Mark as network-sourced
+	for _, sub := range subdomains {
+		// Shared data is untrusted, keep only valid names under the domain
+		host, reason := util.CheckHost(sub.Sub, domain)
+		if reason != "" {
+			continue
+		}
+		row := cache.Row{
+			Sub:       host,
+			FirstSeen: sharedTime(sub.FirstSeen, now),
+			LastSeen:  sharedTime(sub.LastSeen, now),
+			SrcBits:   sub.SrcBits,
+			Sources:   sharedSources(sub.Sources),
 		}
+		if row.FirstSeen > row.LastSeen {
+			row.FirstSeen = row.LastSeen
+		}
+		if row.SrcBits <= 0 {
+			row.SrcBits = 2 // Mark as network-sourced
+		}
+		rows = append(rows, row)
 	}
 
 	return n.localCache.WriteRows(domain, rows)
 }
 
+// sharedSources returns the sorted, distinct upstream source names of a
+// shared row.
+func sharedSources(sources []string) []string {
+	seen := make(map[string]bool, len(sources))
+	var out []string
+	for _, src := range sources {
+		if src == "" || seen[src] {
+			continue
+		}
+		seen[src] = true
+		out = append(out, src)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// sharedTime returns the RFC 3339 timestamp ts of a shared row, or now if it
+// is malformed or in the future.
+func sharedTime(ts string, now time.Time) string {
+	t, err := time.Parse(time.RFC3339, ts)
+	if err != nil || t.After(now) {
+		return now.Format(time.RFC3339)
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
 // updateGlobalIndex updates the global domain index with new hash
 func (n *NetworkDB) updateGlobalIndex(domain, hash string) error {
 	// This would update the global index in IPFS
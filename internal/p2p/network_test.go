@@ -0,0 +1,74 @@
+package p2p
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/amoz0x/nether/internal/cache"
+)
+
+func TestPublicRowsKeepDiscoveryFieldsOnly(t *testing.T) {
+	rows := []cache.Row{
+		{
+			Sub:       "api.example.com",
+			FirstSeen: "2024-01-01T00:00:00Z",
+			LastSeen:  "2024-01-02T00:00:00Z",
+			SrcBits:   3,
+			Sources:   []string{"crtsh"},
+			Misses:    1,
+			DNS:       &cache.Records{A: []string{"192.0.2.1"}, ResolvedAt: "2024-01-02T00:00:00Z"},
+			Findings:  []cache.Finding{{Kind: "takeover", Service: "github", Evidence: "There isn't a GitHub Pages site here."}},
+			HTTP:      []cache.Probe{{URL: "https://api.example.com", Status: 200}},
+		},
+		{Sub: "old.example.com", SrcBits: 1, Status: cache.StatusStale, Misses: 2},
+		{Sub: "gone.example.com", SrcBits: 1, Status: cache.StatusRemoved, Misses: 5},
+	}
+
+	want := []cache.Row{{
+		Sub:       "api.example.com",
+		FirstSeen: "2024-01-01T00:00:00Z",
+		LastSeen:  "2024-01-02T00:00:00Z",
+		SrcBits:   3,
+		Sources:   []string{"crtsh"},
+	}}
+	if got := publicRows(rows); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %+v, got %+v", want, got)
+	}
+}
+
+func TestCacheFromNetworkKeepsSharedMetadata(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(tmpDir, "cache"), 0755); err != nil {
+		t.Fatalf("Failed to create cache dir: %v", err)
+	}
+	c := &cache.Cache{Base: tmpDir}
+	n := &NetworkDB{localCache: c}
+
+	future := time.Now().Add(48 * time.Hour).UTC().Format(time.RFC3339)
+	err := n.cacheFromNetwork("example.com", []cache.Row{
+		{Sub: "api.example.com", FirstSeen: "2024-01-01T00:00:00Z", LastSeen: "2024-01-02T00:00:00Z", SrcBits: 5, Sources: []string{"virustotal", "crtsh", "", "crtsh"}},
+		{Sub: "new.example.com", FirstSeen: "bogus", LastSeen: future},
+		{Sub: "evil.other.com", FirstSeen: "2024-01-01T00:00:00Z", LastSeen: "2024-01-02T00:00:00Z", SrcBits: 1},
+	})
+	if err != nil {
+		t.Fatalf("Failed to cache network rows: %v", err)
+	}
+
+	rows, err := c.Rows("example.com")
+	if err != nil {
+		t.Fatalf("Failed to read rows: %v", err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("Expected 2 rows, got %+v", rows)
+	}
+	want := cache.Row{Sub: "api.example.com", FirstSeen: "2024-01-01T00:00:00Z", LastSeen: "2024-01-02T00:00:00Z", SrcBits: 5, Sources: []string{"crtsh", "virustotal"}}
+	if !reflect.DeepEqual(rows[0], want) {
+		t.Errorf("Expected %+v, got %+v", want, rows[0])
+	}
+	if row := rows[1]; row.SrcBits != 2 || row.FirstSeen == "bogus" || row.LastSeen == future || row.FirstSeen > row.LastSeen {
+		t.Errorf("Expected malformed metadata to be replaced, got %+v", row)
+	}
+}
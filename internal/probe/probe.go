@@ -0,0 +1,257 @@
+// Package probe requests cached subdomains over HTTP and HTTPS and records
+// what answers.
+package probe
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/html"
+
+	"github.com/amoz0x/nether/internal/cache"
+	"github.com/amoz0x/nether/internal/scope"
+)
+
+// maxBody bounds how much of a response is read for the title.
+const maxBody = 1 << 20
+
+// Target is a scheme and port to probe on every host.
+type Target struct {
+	Scheme string
+	Port   int
+}
+
+// URL returns the URL of the target on host, leaving out default ports.
+func (t Target) URL(host string) string {
+	if (t.Scheme == "http" && t.Port == 80) || (t.Scheme == "https" && t.Port == 443) {
+		return t.Scheme + "://" + host + "/"
+	}
+	return t.Scheme + "://" + net.JoinHostPort(host, strconv.Itoa(t.Port)) + "/"
+}
+
+// DefaultPorts is the port list probed unless configured otherwise.
+const DefaultPorts = "80,443"
+
+// ParsePorts parses a comma-separated port list. Entries are a port, which
+// uses HTTPS for 443 and 8443 and HTTP otherwise, or scheme:port.
+func ParsePorts(list string) ([]Target, error) {
+	var targets []Target
+	seen := make(map[Target]bool)
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		scheme := ""
+		if i := strings.Index(entry, ":"); i >= 0 {
+			scheme, entry = strings.ToLower(entry[:i]), entry[i+1:]
+			if scheme != "http" && scheme != "https" {
+				return nil, fmt.Errorf("unknown scheme %q", scheme)
+			}
+		}
+		port, err := strconv.Atoi(entry)
+		if err != nil || port <= 0 || port > 65535 {
+			return nil, fmt.Errorf("invalid port %q", entry)
+		}
+		if scheme == "" {
+			scheme = "http"
+			if port == 443 || port == 8443 {
+				scheme = "https"
+			}
+		}
+
+		t := Target{Scheme: scheme, Port: port}
+		if !seen[t] {
+			seen[t] = true
+			targets = append(targets, t)
+		}
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no ports to probe")
+	}
+	return targets, nil
+}
+
+// Prober probes hosts on a set of targets.
+type Prober struct {
+	Targets []Target
+	Workers int
+	Scope   *scope.Scope // Connections into its excluded ranges are refused, redirects included
+	Client  *http.Client
+}
+
+// NewProber returns a prober with the given timeout per request. Redirects
+// are followed and certificates are not verified.
+func NewProber(targets []Target, timeout time.Duration) *Prober {
+	p := &Prober{
+		Targets: targets,
+		Workers: 25,
+	}
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, c syscall.RawConn) error {
+			return p.Scope.Control(network, address, c)
+		},
+	}
+	p.Client = &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSClientConfig:     &tls.Config{InsecureSkipVerify: true},
+			TLSHandshakeTimeout: timeout,
+			DisableKeepAlives:   true,
+		},
+	}
+	return p
+}
+
+// Probe requests every target on host and returns the responses received.
+func (p *Prober) Probe(ctx context.Context, host string) []cache.Probe {
+	var probes []cache.Probe
+	for _, t := range p.Targets {
+		if probe, err := p.fetch(ctx, t.URL(host)); err == nil {
+			probes = append(probes, probe)
+		}
+	}
+	return probes
+}
+
+// fetch requests url and extracts the recorded metadata.
+func (p *Prober) fetch(ctx context.Context, url string) (cache.Probe, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return cache.Probe{}, err
+	}
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return cache.Probe{}, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBody))
+	if err != nil {
+		return cache.Probe{}, err
+	}
+
+	probe := cache.Probe{
+		URL:           url,
+		Status:        resp.StatusCode,
+		ContentLength: resp.ContentLength,
+		Server:        resp.Header.Get("Server"),
+		ProbedAt:      time.Now().UTC().Format(time.RFC3339),
+	}
+	if probe.ContentLength < 0 {
+		probe.ContentLength = int64(len(body))
+	}
+	if final := resp.Request.URL.String(); final != url {
+		probe.FinalURL = final
+	}
+	if resp.TLS != nil && len(resp.TLS.PeerCertificates) > 0 {
+		probe.TLSSubject = resp.TLS.PeerCertificates[0].Subject.String()
+	}
+
+	var generator string
+	probe.Title, generator = parseHTML(body)
+	for _, tech := range []string{resp.Header.Get("X-Powered-By"), resp.Header.Get("X-Generator"), generator} {
+		if tech != "" {
+			probe.Tech = append(probe.Tech, tech)
+		}
+	}
+	return probe, nil
+}
+
+// parseHTML returns the page title and the content of a generator meta tag.
+func parseHTML(body []byte) (title, generator string) {
+	z := html.NewTokenizer(strings.NewReader(string(body)))
+	inTitle := false
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return title, generator
+		case html.StartTagToken, html.SelfClosingTagToken:
+			tok := z.Token()
+			switch tok.Data {
+			case "title":
+				inTitle = title == ""
+			case "meta":
+				var name, content string
+				for _, attr := range tok.Attr {
+					switch strings.ToLower(attr.Key) {
+					case "name":
+						name = strings.ToLower(attr.Val)
+					case "content":
+						content = attr.Val
+					}
+				}
+				if name == "generator" && generator == "" {
+					generator = strings.TrimSpace(content)
+				}
+			case "body":
+				if title != "" {
+					return title, generator
+				}
+			}
+		case html.TextToken:
+			if inTitle {
+				title = strings.Join(strings.Fields(string(z.Text())), " ")
+				inTitle = false
+			}
+		case html.EndTagToken:
+			inTitle = false
+		}
+	}
+}
+
+// ProbeAll probes hosts with a pool of workers and returns the responses by
+// host. Hosts that were probed without any answer map to nil; hosts skipped
+// because ctx ended are left out.
+func (p *Prober) ProbeAll(ctx context.Context, hosts []string) map[string][]cache.Probe {
+	workers := p.Workers
+	if workers <= 0 {
+		workers = 25
+	}
+
+	var mu sync.Mutex
+	results := make(map[string][]cache.Probe, len(hosts))
+
+	jobs := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for host := range jobs {
+				probes := p.Probe(ctx, host)
+				if ctx.Err() != nil {
+					continue
+				}
+				mu.Lock()
+				results[host] = probes
+				mu.Unlock()
+			}
+		}()
+	}
+
+feed:
+	for _, host := range hosts {
+		select {
+		case jobs <- host:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results
+}
@@ -0,0 +1,112 @@
+package probe
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/amoz0x/nether/internal/scope"
+)
+
+func TestParsePorts(t *testing.T) {
+	got, err := ParsePorts("80, 443,8443,https:9443,8080,80")
+	if err != nil {
+		t.Fatalf("ParsePorts failed: %v", err)
+	}
+	want := []Target{{"http", 80}, {"https", 443}, {"https", 8443}, {"https", 9443}, {"http", 8080}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+
+	for _, bad := range []string{"", "ftp:21", "http:0", "abc"} {
+		if _, err := ParsePorts(bad); err == nil {
+			t.Errorf("Expected error for %q", bad)
+		}
+	}
+}
+
+// serverTarget returns the probe target of a test server.
+func serverTarget(t *testing.T, srv *httptest.Server) Target {
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse server URL: %v", err)
+	}
+	_, port, _ := net.SplitHostPort(u.Host)
+	n, _ := strconv.Atoi(port)
+	return Target{Scheme: u.Scheme, Port: n}
+}
+
+func TestProbeRecordsMetadata(t *testing.T) {
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			http.Redirect(w, r, "/login", http.StatusFound)
+			return
+		}
+		w.Header().Set("Server", "nginx")
+		w.Header().Set("X-Powered-By", "PHP/8.2")
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("<html><head><meta name=\"generator\" content=\"WordPress 6.4\">" +
+			"<title>\n  Sign   in\n</title></head><body><title>not this</title></body></html>"))
+	}))
+	defer plain.Close()
+
+	secure := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer secure.Close()
+
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closedTarget := serverTarget(t, closed)
+	closed.Close()
+
+	p := NewProber([]Target{serverTarget(t, plain), serverTarget(t, secure), closedTarget}, 2*time.Second)
+	results := p.ProbeAll(context.Background(), []string{"127.0.0.1"})
+
+	probes := results["127.0.0.1"]
+	if len(probes) != 2 {
+		t.Fatalf("Expected 2 responses, got %+v", probes)
+	}
+
+	got := probes[0]
+	if got.Status != http.StatusUnauthorized || got.Title != "Sign in" || got.Server != "nginx" {
+		t.Errorf("Unexpected plain probe: %+v", got)
+	}
+	if !strings.HasSuffix(got.FinalURL, "/login") {
+		t.Errorf("Expected redirect to /login, got %q", got.FinalURL)
+	}
+	if want := []string{"PHP/8.2", "WordPress 6.4"}; !reflect.DeepEqual(got.Tech, want) {
+		t.Errorf("Expected tech %v, got %v", want, got.Tech)
+	}
+
+	got = probes[1]
+	if got.Status != http.StatusOK || got.ContentLength != 2 || !strings.HasPrefix(got.URL, "https://") {
+		t.Errorf("Unexpected TLS probe: %+v", got)
+	}
+	if !strings.Contains(got.TLSSubject, "O=Acme Co") {
+		t.Errorf("Expected certificate subject of the test server, got %q", got.TLSSubject)
+	}
+}
+
+func TestProbeSkipsExcludedAddresses(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	sc, err := scope.Parse(strings.NewReader("!127.0.0.0/8\n"))
+	if err != nil {
+		t.Fatalf("Failed to parse scope: %v", err)
+	}
+	p := NewProber([]Target{serverTarget(t, srv)}, 2*time.Second)
+	p.Scope = sc
+	if probes := p.Probe(context.Background(), "127.0.0.1"); len(probes) != 0 {
+		t.Errorf("Expected no request to an excluded address, got %+v", probes)
+	}
+}
@@ -0,0 +1,90 @@
+// Package resolve looks up the DNS records of cached subdomains.
+package resolve
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/amoz0x/nether/internal/cache"
+	"github.com/amoz0x/nether/internal/dns"
+	"github.com/amoz0x/nether/internal/merge"
+	"github.com/amoz0x/nether/internal/scope"
+)
+
+// Hosts resolves hosts with a pool of workers and returns the records of every
+// host that got an answer, NXDOMAIN included. Hosts whose lookups failed, for
+// example on timeouts, are left out so callers keep their previous records.
+func Hosts(ctx context.Context, client *dns.Client, hosts []string, workers int) map[string]cache.Records {
+	if workers <= 0 {
+		workers = 50
+	}
+
+	var mu sync.Mutex
+	records := make(map[string]cache.Records, len(hosts))
+
+	jobs := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for host := range jobs {
+				ans, err := client.Resolve(ctx, host)
+				if err != nil {
+					continue
+				}
+				rec := cache.Records{
+					A:          ans.A,
+					AAAA:       ans.AAAA,
+					CNAME:      ans.CNAME,
+					NXDomain:   ans.NXDomain(),
+					ResolvedAt: time.Now().UTC().Format(time.RFC3339),
+				}
+				mu.Lock()
+				records[host] = rec
+				mu.Unlock()
+			}
+		}()
+	}
+
+feed:
+	for _, host := range hosts {
+		select {
+		case jobs <- host:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	return records
+}
+
+// Root resolves every in-scope cached host of root that has not been removed
+// and stores the records in the cache. It returns the number of hosts resolved;
+// on cancellation the records gathered so far are still stored.
+func Root(ctx context.Context, c *cache.Cache, root string, client *dns.Client, workers int) (int, error) {
+	rows, err := c.Rows(root)
+	if err != nil {
+		return 0, err
+	}
+	sc, err := scope.ForRoot(c, root)
+	if err != nil {
+		return 0, err
+	}
+
+	var hosts []string
+	for _, row := range rows {
+		if row.State() != cache.StatusRemoved && sc.AllowsRow(row) {
+			hosts = append(hosts, row.Sub)
+		}
+	}
+
+	records := Hosts(ctx, client, hosts, workers)
+	if err := merge.SetRecords(root, records, c); err != nil {
+		return 0, err
+	}
+	return len(records), ctx.Err()
+}
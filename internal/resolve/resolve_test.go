@@ -0,0 +1,78 @@
+package resolve
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/amoz0x/nether/internal/cache"
+	"github.com/amoz0x/nether/internal/dns"
+	"github.com/amoz0x/nether/internal/dnstest"
+	"github.com/amoz0x/nether/internal/merge"
+)
+
+func TestRootStoresRecords(t *testing.T) {
+	srv, err := dnstest.NewServer()
+	if err != nil {
+		t.Fatalf("Failed to start DNS server: %v", err)
+	}
+	defer srv.Close()
+
+	srv.AddA("api.example.com", "192.0.2.10")
+	srv.AddAAAA("api.example.com", "2001:db8::10")
+	srv.AddCNAME("www.example.com", "edge.example.net")
+	srv.AddCNAME("edge.example.net", "api.example.com")
+
+	tmpDir, err := os.MkdirTemp("", "blink-resolve-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	for _, dir := range []string{"cache", "deltas"} {
+		if err := os.MkdirAll(filepath.Join(tmpDir, dir), 0755); err != nil {
+			t.Fatalf("Failed to create %s dir: %v", dir, err)
+		}
+	}
+	c := &cache.Cache{Base: tmpDir}
+
+	if _, err := merge.MergeFound("example.com", []string{"api.example.com", "www.example.com", "gone.example.com"}, c, merge.SourceSubfinder); err != nil {
+		t.Fatalf("MergeFound failed: %v", err)
+	}
+
+	n, err := Root(context.Background(), c, "example.com", dns.NewClient([]string{srv.Addr}, 0), 4)
+	if err != nil {
+		t.Fatalf("Root failed: %v", err)
+	}
+	if n != 3 {
+		t.Fatalf("Expected 3 hosts resolved, got %d", n)
+	}
+
+	rows, err := c.Rows("example.com")
+	if err != nil {
+		t.Fatalf("Failed to read rows: %v", err)
+	}
+	bySub := make(map[string]cache.Row)
+	for _, row := range rows {
+		if row.DNS == nil || row.DNS.ResolvedAt == "" {
+			t.Fatalf("Expected %s to carry records with a timestamp, got %+v", row.Sub, row.DNS)
+		}
+		bySub[row.Sub] = row
+	}
+
+	api := bySub["api.example.com"]
+	if !api.Alive() || !reflect.DeepEqual(api.DNS.A, []string{"192.0.2.10"}) || !reflect.DeepEqual(api.DNS.AAAA, []string{"2001:db8::10"}) {
+		t.Errorf("Unexpected records for api: %+v", api.DNS)
+	}
+
+	www := bySub["www.example.com"]
+	if !www.Alive() || !reflect.DeepEqual(www.DNS.CNAME, []string{"edge.example.net", "api.example.com"}) {
+		t.Errorf("Expected www to follow the CNAME chain, got %+v", www.DNS)
+	}
+
+	gone := bySub["gone.example.com"]
+	if gone.Alive() || !gone.DNS.NXDomain {
+		t.Errorf("Expected gone to be NXDOMAIN, got %+v", gone.DNS)
+	}
+}
@@ -0,0 +1,159 @@
+package scan
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/amoz0x/nether/internal/dns"
+	"github.com/amoz0x/nether/internal/util"
+)
+
+// zoneTimeout bounds each zone transfer and each NSEC walk against a single
+// nameserver.
+const zoneTimeout = 30 * time.Second
+
+// ErrNoTransfer is returned by the axfr and nsec scanners when no nameserver
+// allowed a transfer or a complete walk. The scan didn't run rather than
+// failing, so the hosts it would have reported must not be aged.
+var ErrNoTransfer = errors.New("no nameserver allowed a transfer or walk")
+
+// nameserver is an authoritative server of a root, by name and address.
+type nameserver struct {
+	name string
+	addr string // ip:port
+}
+
+// nameservers looks up the NS records of root through client and resolves
+// each to an address on port, which defaults to 53.
+func nameservers(ctx context.Context, root string, client *dns.Client, port string) ([]nameserver, error) {
+	if port == "" {
+		port = "53"
+	}
+
+	names, err := client.Nameservers(ctx, root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up nameservers of %s: %w", root, err)
+	}
+
+	var servers []nameserver
+	for _, name := range names {
+		ans, err := client.Resolve(ctx, name)
+		if err != nil {
+			continue
+		}
+		for _, ip := range append(ans.A, ans.AAAA...) {
+			servers = append(servers, nameserver{name: name, addr: net.JoinHostPort(ip, port)})
+		}
+	}
+	return servers, nil
+}
+
+// zoneHost normalizes a name leaked by a nameserver, dropping the apex and
+// service labels such as _dmarc. Wildcard owners yield the name they are
+// rooted at.
+func zoneHost(name, root string) string {
+	host, reason := util.CheckHost(name, root)
+	if reason != "" || host == root {
+		return ""
+	}
+	return host
+}
+
+// axfrScanner requests a zone transfer of the root from each of its
+// nameservers. Results carry the name of the nameserver that allowed it.
+type axfrScanner struct {
+	opts Options
+	port string // Nameserver port; empty uses 53
+}
+
+func (a *axfrScanner) Name() string { return "axfr" }
+
+// Run streams every name of the zone from the nameservers that allow
+// transfers. Refusals are expected; when every server refuses, Run returns
+// ErrNoTransfer.
+func (a *axfrScanner) Run(ctx context.Context, root string, out chan<- Result) error {
+	servers, err := nameservers(ctx, root, a.opts.client(), a.port)
+	if err != nil {
+		return err
+	}
+
+	transferred := false
+	emitted := make(map[string]bool)
+	for _, ns := range servers {
+		tctx, cancel := context.WithTimeout(ctx, zoneTimeout)
+		names, err := dns.Transfer(tctx, ns.addr, root)
+		cancel()
+		if err != nil {
+			continue
+		}
+		transferred = true
+		for _, name := range names {
+			host := zoneHost(name, root)
+			if host == "" || emitted[ns.name+" "+host] {
+				continue
+			}
+			emitted[ns.name+" "+host] = true
+			select {
+			case out <- Result{Host: host, Source: ns.name}:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if !transferred {
+		return ErrNoTransfer
+	}
+	return nil
+}
+
+// nsecScanner walks the NSEC chain of a DNSSEC-signed root on its
+// nameservers. Results carry the name of the nameserver that was walked.
+type nsecScanner struct {
+	opts Options
+	port string // Nameserver port; empty uses 53
+}
+
+func (n *nsecScanner) Name() string { return "nsec" }
+
+// Run streams the names found by walking the zone on its nameservers,
+// stopping after the first complete walk. Unsigned zones and zones using
+// NSEC3 yield nothing; without a complete walk Run returns ErrNoTransfer.
+func (n *nsecScanner) Run(ctx context.Context, root string, out chan<- Result) error {
+	client := n.opts.client()
+	servers, err := nameservers(ctx, root, client, n.port)
+	if err != nil {
+		return err
+	}
+
+	emitted := make(map[string]bool)
+	for _, ns := range servers {
+		wctx, cancel := context.WithTimeout(ctx, zoneTimeout)
+		names, err := client.WithServers([]string{ns.addr}).WalkNSEC(wctx, root)
+		cancel()
+		for _, name := range names {
+			host := zoneHost(name, root)
+			if host == "" || emitted[host] {
+				continue
+			}
+			emitted[host] = true
+			select {
+			case out <- Result{Host: host, Source: ns.name}:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		if err == nil && len(names) > 0 {
+			return nil
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return ErrNoTransfer
+}
@@ -0,0 +1,112 @@
+package scan
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/amoz0x/nether/internal/dnstest"
+)
+
+// zoneServer starts a DNS server that both resolves the nameservers of
+// example.com and answers for the zone itself.
+func zoneServer(t *testing.T) (*dnstest.Server, string) {
+	srv, err := dnstest.NewServer()
+	if err != nil {
+		t.Fatalf("Failed to start DNS server: %v", err)
+	}
+	t.Cleanup(srv.Close)
+
+	_, port, err := net.SplitHostPort(srv.Addr)
+	if err != nil {
+		t.Fatalf("Failed to parse server address: %v", err)
+	}
+
+	srv.AddNS("example.com", "ns1.example.com")
+	srv.AddA("ns1.example.com", "127.0.0.1")
+	srv.AddA("api.example.com", "192.0.2.10")
+	srv.AddCNAME("www.example.com", "api.example.com")
+	srv.AddA("*.dev.example.com", "192.0.2.20")
+	srv.AddA("_dmarc.example.com", "192.0.2.30")
+	srv.AddA("other.example.net", "192.0.2.40")
+	return srv, port
+}
+
+// collect runs s against example.com and returns the results sorted by host
+// and the error of the scanner.
+func collect(s Scanner) ([]Result, error) {
+	out := make(chan Result)
+	var results []Result
+	done := make(chan struct{})
+	go func() {
+		for r := range out {
+			results = append(results, r)
+		}
+		close(done)
+	}()
+
+	err := s.Run(context.Background(), "example.com", out)
+	close(out)
+	<-done
+
+	sort.Slice(results, func(i, j int) bool { return results[i].Host < results[j].Host })
+	return results, err
+}
+
+func TestAXFRScannerRecordsNameserver(t *testing.T) {
+	srv, port := zoneServer(t)
+	opts := Options{Resolvers: []string{srv.Addr}}
+
+	// Transfers are refused until allowed, and a refusal doesn't count as a scan
+	got, err := collect(&axfrScanner{opts: opts, port: port})
+	if len(got) != 0 || !errors.Is(err, ErrNoTransfer) {
+		t.Fatalf("Expected ErrNoTransfer and no results from a refused transfer, got %v (%v)", got, err)
+	}
+
+	srv.AllowTransfer("example.com")
+	got, err = collect(&axfrScanner{opts: opts, port: port})
+	if err != nil {
+		t.Fatalf("axfr scanner failed: %v", err)
+	}
+	want := []Result{
+		{Host: "api.example.com", Source: "ns1.example.com"},
+		{Host: "dev.example.com", Source: "ns1.example.com"},
+		{Host: "ns1.example.com", Source: "ns1.example.com"},
+		{Host: "www.example.com", Source: "ns1.example.com"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
+
+func TestNSECScannerWalksChain(t *testing.T) {
+	srv, port := zoneServer(t)
+	opts := Options{Resolvers: []string{srv.Addr}}
+
+	// Unsigned zones yield nothing, and don't count as a scan
+	got, err := collect(&nsecScanner{opts: opts, port: port})
+	if len(got) != 0 || !errors.Is(err, ErrNoTransfer) {
+		t.Fatalf("Expected ErrNoTransfer and no results from an unsigned zone, got %v (%v)", got, err)
+	}
+
+	srv.AddNSEC("example.com", "api.example.com")
+	srv.AddNSEC("api.example.com", "hidden.example.com")
+	srv.AddNSEC("hidden.example.com", "ns1.example.com")
+	srv.AddNSEC("ns1.example.com", "example.com")
+
+	got, err = collect(&nsecScanner{opts: opts, port: port})
+	if err != nil {
+		t.Fatalf("nsec scanner failed: %v", err)
+	}
+	want := []Result{
+		{Host: "api.example.com", Source: "ns1.example.com"},
+		{Host: "hidden.example.com", Source: "ns1.example.com"},
+		{Host: "ns1.example.com", Source: "ns1.example.com"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
@@ -0,0 +1,115 @@
+package scan
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/amoz0x/nether/internal/dns"
+	"github.com/amoz0x/nether/internal/util"
+	"github.com/amoz0x/nether/wordlists"
+)
+
+// bruteScanner resolves every wordlist label under the root.
+type bruteScanner struct {
+	opts Options
+}
+
+func (b *bruteScanner) Name() string { return "brute" }
+
+// Run streams the wordlist candidates under root that exist in DNS.
+func (b *bruteScanner) Run(ctx context.Context, root string, out chan<- Result) error {
+	words, err := LoadWordlist(b.opts.Wordlist)
+	if err != nil {
+		return err
+	}
+
+	var candidates []string
+	for _, word := range words {
+		if host := util.NormalizeHost(word + "." + root); host != "" {
+			candidates = append(candidates, host)
+		}
+	}
+
+	return resolveCandidates(ctx, candidates, b.opts, out)
+}
+
+// resolveCandidates looks up each in-scope candidate with a pool of workers
+// and sends the names that exist to out. AAAA is only queried for names
+// without an A record that don't return NXDOMAIN.
+func resolveCandidates(ctx context.Context, candidates []string, opts Options, out chan<- Result) error {
+	candidates = opts.Scope.Filter(candidates)
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = 50
+	}
+	client := opts.client()
+
+	jobs := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for host := range jobs {
+				ans, err := client.Query(ctx, host, dns.TypeA)
+				if err == nil && !ans.Exists() && !ans.NXDomain() {
+					// The name exists without an A record, e.g. an IPv6-only host
+					ans, err = client.Query(ctx, host, dns.TypeAAAA)
+				}
+				if err != nil || !ans.Exists() {
+					continue
+				}
+				out <- Result{Host: host}
+			}
+		}()
+	}
+
+feed:
+	for _, host := range candidates {
+		select {
+		case jobs <- host:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	return ctx.Err()
+}
+
+// LoadWordlist reads labels from path, or from the bundled quick list when
+// path is empty. Blank lines and #-comments are skipped and duplicates removed.
+func LoadWordlist(path string) ([]string, error) {
+	var r io.Reader = strings.NewReader(wordlists.Quick)
+	if path != "" {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open wordlist: %w", err)
+		}
+		defer file.Close()
+		r = file
+	}
+
+	seen := make(map[string]bool)
+	var words []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		word := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		if word == "" || strings.HasPrefix(word, "#") || seen[word] {
+			continue
+		}
+		seen[word] = true
+		words = append(words, word)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read wordlist: %w", err)
+	}
+
+	return words, nil
+}
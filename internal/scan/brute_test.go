@@ -0,0 +1,143 @@
+package scan
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/amoz0x/nether/internal/dnstest"
+)
+
+func TestBruteScannerAgainstLocalServer(t *testing.T) {
+	srv, err := dnstest.NewServer()
+	if err != nil {
+		t.Fatalf("Failed to start DNS server: %v", err)
+	}
+	defer srv.Close()
+
+	srv.AddA("api.example.com", "192.0.2.10")
+	srv.AddCNAME("dev.example.com", "api.example.com")
+	srv.AddAAAA("v6.example.com", "2001:db8::1")
+	srv.AddCNAME("v6alias.example.com", "v6.example.com")
+
+	tmpDir, err := os.MkdirTemp("", "blink-brute-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	wordlist := filepath.Join(tmpDir, "words.txt")
+	if err := os.WriteFile(wordlist, []byte("api\n# comment\nDEV\nmissing\napi\nv6\nv6alias\n"), 0644); err != nil {
+		t.Fatalf("Failed to write wordlist: %v", err)
+	}
+
+	scanners, err := Lookup([]string{"brute"}, Options{
+		Wordlist:  wordlist,
+		Resolvers: []string{srv.Addr},
+		Workers:   4,
+		QPS:       1000,
+	})
+	if err != nil {
+		t.Fatalf("Failed to build brute scanner: %v", err)
+	}
+
+	out := make(chan Result)
+	var found []string
+	done := make(chan struct{})
+	go func() {
+		for r := range out {
+			if r.Scanner != "brute" {
+				t.Errorf("Expected result tagged brute, got %q", r.Scanner)
+			}
+			found = append(found, r.Host)
+		}
+		close(done)
+	}()
+
+	errs := RunAll(context.Background(), "example.com", scanners, out)
+	close(out)
+	<-done
+	if len(errs) > 0 {
+		t.Fatalf("Brute scan failed: %v", errs)
+	}
+	sort.Strings(found)
+
+	// v6 only has an AAAA record, found by falling back from an empty A answer
+	expected := []string{"api.example.com", "dev.example.com", "v6.example.com", "v6alias.example.com"}
+	if len(found) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, found)
+	}
+	for i, sub := range found {
+		if sub != expected[i] {
+			t.Errorf("Expected found[%d] = %s, got %s", i, expected[i], sub)
+		}
+	}
+
+	// One query per unique label, plus an AAAA query for v6 only
+	if q := srv.Queries(); q != 6 {
+		t.Errorf("Expected 6 queries, got %d", q)
+	}
+}
+
+func TestScannersShareQueryRate(t *testing.T) {
+	srv, err := dnstest.NewServer()
+	if err != nil {
+		t.Fatalf("Failed to start DNS server: %v", err)
+	}
+	defer srv.Close()
+	srv.AddA("api.example.com", "192.0.2.10")
+
+	var words []string
+	for i := 0; i < 200; i++ {
+		words = append(words, fmt.Sprintf("w%d", i))
+	}
+	wordlist := filepath.Join(t.TempDir(), "words.txt")
+	if err := os.WriteFile(wordlist, []byte(strings.Join(words, "\n")), 0644); err != nil {
+		t.Fatalf("Failed to write wordlist: %v", err)
+	}
+
+	// brute and ptr both have far more queries to send than the rate allows
+	const qps = 20
+	scanners, err := Lookup([]string{"brute", "ptr"}, Options{
+		Wordlist:  wordlist,
+		Resolvers: []string{srv.Addr},
+		Workers:   8,
+		QPS:       qps,
+	})
+	if err != nil {
+		t.Fatalf("Failed to build scanners: %v", err)
+	}
+	scanners[1].(Seeded).Seed([]string{"api.example.com"})
+
+	out := make(chan Result)
+	go func() {
+		for range out {
+		}
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	start := time.Now()
+	RunAll(ctx, "example.com", scanners, out)
+	close(out)
+
+	// One shared limiter allows qps per second in total, not per scanner
+	limit := int(time.Since(start).Seconds()*qps) + 2
+	if q := srv.Queries(); q > limit {
+		t.Errorf("Expected at most %d queries from both scanners, got %d", limit, q)
+	}
+}
+
+func TestLoadWordlistBundled(t *testing.T) {
+	words, err := LoadWordlist("")
+	if err != nil {
+		t.Fatalf("Failed to load bundled wordlist: %v", err)
+	}
+	if len(words) == 0 {
+		t.Fatalf("Expected bundled wordlist to contain labels")
+	}
+}
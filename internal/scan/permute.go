@@ -0,0 +1,149 @@
+package scan
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxPermutations caps the candidates generated for a single root.
+const maxPermutations = 50000
+
+// envWords are environment labels that are swapped for one another.
+var envWords = []string{"dev", "development", "stage", "staging", "stg", "test", "qa", "uat", "preprod", "prod", "production", "sandbox"}
+
+var numberPattern = regexp.MustCompile(`[0-9]+`)
+
+// permuteScanner resolves alterations of the hosts already known for a root.
+type permuteScanner struct {
+	opts  Options
+	seeds []string
+}
+
+func (p *permuteScanner) Name() string { return "permute" }
+
+// Seed sets the known hosts the permutations are derived from.
+func (p *permuteScanner) Seed(hosts []string) { p.seeds = hosts }
+
+// Run streams the permutations of the seeded hosts that exist in DNS.
+func (p *permuteScanner) Run(ctx context.Context, root string, out chan<- Result) error {
+	words, err := LoadWordlist(p.opts.Wordlist)
+	if err != nil {
+		return err
+	}
+	return resolveCandidates(ctx, Permutations(root, p.seeds, words, maxPermutations), p.opts, out)
+}
+
+// Permutations derives candidate names under root from known hosts by
+// inserting words as new labels, joining them to labels with dashes,
+// incrementing and decrementing numbers, and swapping environment names such
+// as dev, stage and prod. Known hosts are left out and at most limit
+// candidates are returned.
+func Permutations(root string, known []string, words []string, limit int) []string {
+	hosts := append([]string(nil), known...)
+	sort.Strings(hosts)
+
+	seen := make(map[string]bool, len(hosts))
+	for _, host := range hosts {
+		seen[host] = true
+	}
+
+	var out []string
+	add := func(labels []string) bool {
+		for _, label := range labels {
+			if label == "" || len(label) > 63 || strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-") {
+				return true
+			}
+		}
+		name := strings.Join(labels, ".") + "." + root
+		if len(name) > 253 || seen[name] {
+			return true
+		}
+		seen[name] = true
+		out = append(out, name)
+		return len(out) < limit
+	}
+
+	for _, host := range hosts {
+		if !strings.HasSuffix(host, "."+root) {
+			continue
+		}
+		labels := strings.Split(strings.TrimSuffix(host, "."+root), ".")
+		for _, candidate := range alterations(labels, words) {
+			if !add(candidate) {
+				return out
+			}
+		}
+	}
+	return out
+}
+
+// alterations returns the label lists derived from labels.
+func alterations(labels []string, words []string) [][]string {
+	var out [][]string
+	replace := func(i int, label string) {
+		alt := append([]string(nil), labels...)
+		alt[i] = label
+		out = append(out, alt)
+	}
+
+	// Word insertion as a new label at every position
+	for pos := 0; pos <= len(labels); pos++ {
+		for _, w := range words {
+			alt := append(append(append([]string(nil), labels[:pos]...), w), labels[pos:]...)
+			out = append(out, alt)
+		}
+	}
+
+	for i, label := range labels {
+		// Dash joins
+		for _, w := range words {
+			replace(i, label+"-"+w)
+			replace(i, w+"-"+label)
+		}
+
+		// Number increments, keeping zero padding
+		for _, loc := range numberPattern.FindAllStringIndex(label, -1) {
+			digits := label[loc[0]:loc[1]]
+			n, err := strconv.Atoi(digits)
+			if err != nil {
+				continue
+			}
+			for _, v := range []int{n - 1, n + 1, n + 2} {
+				if v < 0 {
+					continue
+				}
+				replace(i, label[:loc[0]]+fmt.Sprintf("%0*d", len(digits), v)+label[loc[1]:])
+			}
+		}
+
+		// Environment swaps on the label or its dash-separated parts
+		parts := strings.Split(label, "-")
+		for j, part := range parts {
+			if !isEnvWord(part) {
+				continue
+			}
+			for _, env := range envWords {
+				if env == part {
+					continue
+				}
+				alt := append([]string(nil), parts...)
+				alt[j] = env
+				replace(i, strings.Join(alt, "-"))
+			}
+		}
+	}
+	return out
+}
+
+func isEnvWord(s string) bool {
+	for _, env := range envWords {
+		if s == env {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,83 @@
+package scan
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	"github.com/amoz0x/nether/internal/dnstest"
+)
+
+func TestPermutations(t *testing.T) {
+	known := []string{"api2.dev.example.com", "web-stage.example.com", "example.com", "www.other.org"}
+	got := make(map[string]bool)
+	for _, name := range Permutations("example.com", known, []string{"auth"}, 1000) {
+		got[name] = true
+	}
+
+	for _, want := range []string{
+		"auth.api2.dev.example.com", // Insertion
+		"api2.auth.dev.example.com",
+		"api2.dev.auth.example.com",
+		"api2-auth.dev.example.com", // Dash join
+		"api2.auth-dev.example.com",
+		"api1.dev.example.com", // Number increments
+		"api3.dev.example.com",
+		"api4.dev.example.com",
+		"api2.prod.example.com", // Environment swaps
+		"web-prod.example.com",
+		"web-staging.example.com",
+	} {
+		if !got[want] {
+			t.Errorf("Expected %s among the permutations", want)
+		}
+	}
+	for _, unwanted := range []string{"api2.dev.example.com", "auth.www.other.org", "auth.example.com"} {
+		if got[unwanted] {
+			t.Errorf("Did not expect %s among the permutations", unwanted)
+		}
+	}
+
+	if n := len(Permutations("example.com", known, []string{"auth"}, 5)); n != 5 {
+		t.Errorf("Expected the limit to cap candidates at 5, got %d", n)
+	}
+}
+
+func TestPermuteScannerAgainstLocalServer(t *testing.T) {
+	srv, err := dnstest.NewServer()
+	if err != nil {
+		t.Fatalf("Failed to start DNS server: %v", err)
+	}
+	defer srv.Close()
+
+	srv.AddA("api.dev.example.com", "192.0.2.10")
+	srv.AddA("api.prod.example.com", "192.0.2.11")
+	srv.AddA("api-auth.dev.example.com", "192.0.2.12")
+
+	scanners, err := Lookup([]string{"permute"}, Options{Resolvers: []string{srv.Addr}, Workers: 4})
+	if err != nil {
+		t.Fatalf("Failed to build permute scanner: %v", err)
+	}
+	scanners[0].(Seeded).Seed([]string{"api.dev.example.com"})
+
+	out := make(chan Result)
+	done := make(chan []string)
+	go func() {
+		var found []string
+		for r := range out {
+			found = append(found, r.Host)
+		}
+		done <- found
+	}()
+	errs := RunAll(context.Background(), "example.com", scanners, out)
+	close(out)
+	found := <-done
+
+	if len(errs) != 0 {
+		t.Fatalf("Expected no errors, got %v", errs)
+	}
+	sort.Strings(found)
+	if len(found) != 2 || found[0] != "api-auth.dev.example.com" || found[1] != "api.prod.example.com" {
+		t.Errorf("Expected api-auth.dev and api.prod, got %v", found)
+	}
+}
@@ -0,0 +1,163 @@
+package scan
+
+import (
+	"context"
+	"net/netip"
+	"sort"
+	"sync"
+
+	"github.com/amoz0x/nether/internal/util"
+)
+
+// Default neighbourhoods swept around each resolved address.
+const (
+	DefaultPTRPrefix  = 24
+	DefaultPTRPrefix6 = 120
+)
+
+// maxSweep caps the addresses looked up by a single ptr sweep.
+const maxSweep = 1 << 16
+
+// ptrScanner resolves the known hosts and looks up PTR records across the
+// address ranges around them, keeping the names that fall under the root.
+type ptrScanner struct {
+	opts  Options
+	seeds []string
+}
+
+func (p *ptrScanner) Name() string { return "ptr" }
+
+// Seed sets the hosts whose addresses anchor the sweep.
+func (p *ptrScanner) Seed(hosts []string) { p.seeds = hosts }
+
+// Run streams the in-scope names found by reverse lookups of the
+// neighbourhoods of the seeded hosts' addresses.
+func (p *ptrScanner) Run(ctx context.Context, root string, out chan<- Result) error {
+	client := p.opts.client()
+
+	var (
+		mu    sync.Mutex
+		addrs []netip.Addr
+	)
+	pool(ctx, p.opts.Workers, p.opts.Scope.Filter(p.seeds), func(host string) {
+		ans, err := client.Resolve(ctx, host)
+		if err != nil {
+			return
+		}
+		for _, ip := range append(ans.A, ans.AAAA...) {
+			if addr, err := netip.ParseAddr(ip); err == nil && p.opts.Scope.AllowsAddr(addr) {
+				mu.Lock()
+				addrs = append(addrs, addr)
+				mu.Unlock()
+			}
+		}
+	})
+
+	prefix4, prefix6 := p.opts.PTRPrefix, p.opts.PTRPrefix6
+	if prefix4 <= 0 {
+		prefix4 = DefaultPTRPrefix
+	}
+	if prefix6 <= 0 {
+		prefix6 = DefaultPTRPrefix6
+	}
+
+	var sweep []netip.Addr
+	for _, addr := range Neighbours(addrs, prefix4, prefix6, maxSweep) {
+		if p.opts.Scope.AllowsAddr(addr) {
+			sweep = append(sweep, addr)
+		}
+	}
+
+	emitted := make(map[string]bool)
+	pool(ctx, p.opts.Workers, sweep, func(addr netip.Addr) {
+		names, err := client.LookupPTR(ctx, addr)
+		if err != nil {
+			return
+		}
+		for _, name := range names {
+			host := util.NormalizeHost(name)
+			if host == root || !inScope(host, root) || !p.opts.Scope.Allows(host) {
+				continue
+			}
+			mu.Lock()
+			dup := emitted[host]
+			emitted[host] = true
+			mu.Unlock()
+			if dup {
+				continue
+			}
+			select {
+			case out <- Result{Host: host}:
+			case <-ctx.Done():
+			}
+		}
+	})
+
+	return ctx.Err()
+}
+
+// Neighbours expands addrs to the networks of the given prefix lengths that
+// contain them and returns every address in those networks, in order and
+// without duplicates. At most limit addresses are returned.
+func Neighbours(addrs []netip.Addr, prefix4, prefix6, limit int) []netip.Addr {
+	seen := make(map[netip.Prefix]bool)
+	var nets []netip.Prefix
+	for _, addr := range addrs {
+		addr = addr.Unmap()
+		bits := prefix6
+		if addr.Is4() {
+			bits = prefix4
+		}
+		network, err := addr.Prefix(bits)
+		if err != nil || seen[network] {
+			continue
+		}
+		seen[network] = true
+		nets = append(nets, network)
+	}
+	sort.Slice(nets, func(i, j int) bool { return nets[i].Addr().Less(nets[j].Addr()) })
+
+	var out []netip.Addr
+	for _, network := range nets {
+		for addr := network.Addr(); network.Contains(addr); addr = addr.Next() {
+			if len(out) >= limit {
+				return out
+			}
+			out = append(out, addr)
+			if !addr.Next().IsValid() {
+				break
+			}
+		}
+	}
+	return out
+}
+
+// pool calls fn for each item with a number of concurrent workers, stopping
+// early when ctx is cancelled.
+func pool[T any](ctx context.Context, workers int, items []T, fn func(T)) {
+	if workers <= 0 {
+		workers = 50
+	}
+	jobs := make(chan T)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for item := range jobs {
+				fn(item)
+			}
+		}()
+	}
+
+feed:
+	for _, item := range items {
+		select {
+		case jobs <- item:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+}
@@ -0,0 +1,63 @@
+package scan
+
+import (
+	"net/netip"
+	"reflect"
+	"testing"
+)
+
+func TestNeighboursExpandsNetworks(t *testing.T) {
+	addrs := []netip.Addr{
+		netip.MustParseAddr("192.0.2.77"),
+		netip.MustParseAddr("192.0.2.9"),
+		netip.MustParseAddr("::ffff:192.0.2.78"), // Mapped, in the same /30 as .77
+		netip.MustParseAddr("2001:db8::1"),
+	}
+
+	got := Neighbours(addrs, 30, 127, 100)
+	want := []netip.Addr{
+		netip.MustParseAddr("192.0.2.8"),
+		netip.MustParseAddr("192.0.2.9"),
+		netip.MustParseAddr("192.0.2.10"),
+		netip.MustParseAddr("192.0.2.11"),
+		netip.MustParseAddr("192.0.2.76"),
+		netip.MustParseAddr("192.0.2.77"),
+		netip.MustParseAddr("192.0.2.78"),
+		netip.MustParseAddr("192.0.2.79"),
+		netip.MustParseAddr("2001:db8::"),
+		netip.MustParseAddr("2001:db8::1"),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+
+	if got := Neighbours(addrs, 24, 120, 5); len(got) != 5 {
+		t.Errorf("Expected the sweep to be capped at 5 addresses, got %d", len(got))
+	}
+}
+
+func TestPTRScannerFindsNeighbours(t *testing.T) {
+	srv, _ := zoneServer(t)
+	srv.AddPTR("192.0.2.11", "mail.example.com.")
+	srv.AddPTR("192.0.2.12", "API.example.com")
+	srv.AddPTR("192.0.2.13", "host.example.net")
+	srv.AddPTR("192.0.3.1", "far.example.com")
+	srv.AddPTR("2001:db8::5", "v6.example.com")
+	srv.AddAAAA("v6host.example.com", "2001:db8::1")
+
+	s := &ptrScanner{opts: Options{Resolvers: []string{srv.Addr}, Workers: 8}}
+	s.Seed([]string{"api.example.com", "v6host.example.com", "missing.example.com"})
+
+	got, err := collect(s)
+	if err != nil {
+		t.Fatalf("ptr scanner failed: %v", err)
+	}
+	want := []Result{
+		{Host: "api.example.com"},
+		{Host: "mail.example.com"},
+		{Host: "v6.example.com"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
@@ -0,0 +1,210 @@
+package scan
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/amoz0x/nether/internal/dns"
+	"github.com/amoz0x/nether/internal/merge"
+	"github.com/amoz0x/nether/internal/scope"
+)
+
+// Result is a single subdomain reported by a scanner.
+type Result struct {
+	Host    string // Hostname as reported, cleaned with util.CleanHost; consumers validate it with util.CheckHost
+	Source  string // Upstream source reported by the tool, e.g. crtsh, or the leaking nameserver; may be empty
+	Scanner string // Name of the scanner that produced the result, set by RunAll
+}
+
+// Scanner is a subdomain discovery source.
+type Scanner interface {
+	// Name returns the identifier used to select the scanner with --sources.
+	Name() string
+	// Run enumerates subdomains of root, sending each one on out as it is
+	// found. It returns when enumeration finishes or ctx is cancelled.
+	Run(ctx context.Context, root string, out chan<- Result) error
+}
+
+// Seeded is implemented by scanners that expand on hosts already known for
+// the root, such as TLS certificate harvesting. Callers run them after the
+// other scanners and pass every host found so far to Seed before Run.
+type Seeded interface {
+	Scanner
+	Seed(hosts []string)
+}
+
+// Options carries settings shared by the built-in scanners.
+type Options struct {
+	Wordlist  string   // Path to a wordlist for brute and permute; empty uses the bundled quick list
+	Resolvers []string // Resolver addresses; empty uses dns.DefaultResolvers
+	Workers   int      // Concurrent DNS lookups (default 50)
+	QPS       int      // DNS query rate limit shared by all scanners; 0 disables limiting
+	TLSPorts  []int    // Ports the tls scanner connects to (default 443)
+
+	PTRPrefix  int // IPv4 prefix length of the ranges swept by ptr (default 24)
+	PTRPrefix6 int // IPv6 prefix length of the ranges swept by ptr (default 120)
+
+	Scope *scope.Scope // Hosts and ranges native scanners may contact; nil allows all
+
+	// DNS is the client every native scanner queries through, so QPS caps
+	// them together. Lookup builds one from Resolvers and QPS when nil;
+	// callers running several scans at once pass their own to share it.
+	DNS *dns.Client
+}
+
+// client returns the shared DNS client, or a new one for scanners built
+// without Lookup.
+func (o Options) client() *dns.Client {
+	if o.DNS != nil {
+		return o.DNS
+	}
+	return dns.NewClient(o.Resolvers, o.QPS)
+}
+
+// Factory builds a scanner from the shared options.
+type Factory func(opts Options) Scanner
+
+type registration struct {
+	bit     int
+	factory Factory
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]registration)
+)
+
+func init() {
+	Register("subfinder", merge.SourceSubfinder, func(Options) Scanner { return subfinderScanner{} })
+	Register("brute", merge.SourceBrute, func(opts Options) Scanner { return &bruteScanner{opts: opts} })
+	Register("amass", merge.SourceAmass, func(Options) Scanner {
+		return &toolScanner{name: "amass", bin: "amass", args: func(root string) []string {
+			return []string{"enum", "-passive", "-nocolor", "-d", root}
+		}}
+	})
+	Register("assetfinder", merge.SourceAssetfinder, func(Options) Scanner {
+		return &toolScanner{name: "assetfinder", bin: "assetfinder", args: func(root string) []string {
+			return []string{"--subs-only", root}
+		}}
+	})
+	Register("findomain", merge.SourceFindomain, func(Options) Scanner {
+		return &toolScanner{name: "findomain", bin: "findomain", args: func(root string) []string {
+			return []string{"--quiet", "-t", root}
+		}}
+	})
+	Register("tls", merge.SourceTLS, func(opts Options) Scanner { return &tlsScanner{opts: opts} })
+	Register("permute", merge.SourcePermute, func(opts Options) Scanner { return &permuteScanner{opts: opts} })
+	Register("axfr", merge.SourceAXFR, func(opts Options) Scanner { return &axfrScanner{opts: opts} })
+	Register("nsec", merge.SourceNSEC, func(opts Options) Scanner { return &nsecScanner{opts: opts} })
+	Register("ptr", merge.SourcePTR, func(opts Options) Scanner { return &ptrScanner{opts: opts} })
+}
+
+// Register makes a scanner available under name. The source bit is stored in
+// Row.SrcBits for every subdomain the scanner reports.
+func Register(name string, bit int, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[name] = registration{bit: bit, factory: factory}
+}
+
+// Names returns the names of all registered scanners in sorted order.
+func Names() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	return namesLocked()
+}
+
+// SourceBit returns the source bit registered for a scanner name, or 0.
+func SourceBit(name string) int {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	return registry[name].bit
+}
+
+// Lookup builds the named scanners, rejecting unknown names.
+func Lookup(names []string, opts Options) ([]Scanner, error) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	if opts.DNS == nil {
+		opts.DNS = dns.NewClient(opts.Resolvers, opts.QPS)
+	}
+
+	seen := make(map[string]bool)
+	var scanners []Scanner
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" || seen[name] {
+			continue
+		}
+		reg, ok := registry[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown source %q (available: %s)", name, strings.Join(namesLocked(), ", "))
+		}
+		seen[name] = true
+		scanners = append(scanners, reg.factory(opts))
+	}
+
+	if len(scanners) == 0 {
+		return nil, fmt.Errorf("no sources selected")
+	}
+	return scanners, nil
+}
+
+// inScope reports whether host is root or one of its subdomains.
+func inScope(host, root string) bool {
+	return host == root || strings.HasSuffix(host, "."+root)
+}
+
+func namesLocked() []string {
+	var names []string
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// RunAll runs scanners concurrently against root and forwards their results
+// to out, tagged with the scanner name. It returns once every scanner has
+// finished; failures are reported per scanner name.
+func RunAll(ctx context.Context, root string, scanners []Scanner, out chan<- Result) map[string]error {
+	var (
+		mu   sync.Mutex
+		errs = make(map[string]error)
+		wg   sync.WaitGroup
+	)
+
+	for _, s := range scanners {
+		wg.Add(1)
+		go func(s Scanner) {
+			defer wg.Done()
+
+			results := make(chan Result)
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				for r := range results {
+					r.Scanner = s.Name()
+					out <- r
+				}
+			}()
+
+			err := s.Run(ctx, root, results)
+			close(results)
+			<-done
+
+			if err != nil {
+				mu.Lock()
+				errs[s.Name()] = err
+				mu.Unlock()
+			}
+		}(s)
+	}
+
+	wg.Wait()
+	return errs
+}
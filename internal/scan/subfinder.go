@@ -1,4 +1,4 @@
-// Package scan provides integration with external subdomain enumeration tools.
+// Package scan provides subdomain discovery sources, both external tools and native scanners.
 package scan
 
 import (
@@ -6,6 +6,8 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"os"
 	"os/exec"
 	"strings"
 	"time"
@@ -19,69 +21,108 @@ type sfRow struct {
 	Source string `json:"source,omitempty"`
 }
 
-// RunSubfinder executes subfinder and returns normalized unique subdomains.
-func RunSubfinder(root string) ([]string, error) {
-	// Check if subfinder is available
-	if _, err := exec.LookPath("subfinder"); err != nil {
-		return nil, fmt.Errorf("subfinder not found in PATH: %w\nInstall from: https://github.com/projectdiscovery/subfinder", err)
+// subfinderScanner runs projectdiscovery's subfinder with JSON output.
+type subfinderScanner struct{}
+
+func (subfinderScanner) Name() string { return "subfinder" }
+
+// Run executes subfinder and streams the cleaned subdomains it reports.
+func (subfinderScanner) Run(ctx context.Context, root string, out chan<- Result) error {
+	return runTool(ctx, "subfinder", []string{"-d", root, "-all", "-silent", "-json"},
+		"https://github.com/projectdiscovery/subfinder", func(line string) (Result, bool) {
+			var row sfRow
+			if err := json.Unmarshal([]byte(line), &row); err != nil {
+				// Log warning but continue
+				fmt.Fprintf(os.Stderr, "Warning: invalid JSON from subfinder: %s\n", line)
+				return Result{}, false
+			}
+			return Result{Host: util.CleanHost(row.Host), Source: row.Source}, true
+		}, out)
+}
+
+// toolScanner runs an external tool that prints one hostname per line.
+type toolScanner struct {
+	name string
+	bin  string
+	args func(root string) []string
+}
+
+func (t *toolScanner) Name() string { return t.name }
+
+// Run executes the tool and streams the cleaned hostname of every line.
+func (t *toolScanner) Run(ctx context.Context, root string, out chan<- Result) error {
+	return runTool(ctx, t.bin, t.args(root), "", func(line string) (Result, bool) {
+		// Some tools decorate lines (amass prints "name (FQDN) --> ..."), keep the first field
+		return Result{Host: util.CleanHost(strings.Fields(line)[0])}, true
+	}, out)
+}
+
+// runTool starts bin, parses each non-blank stdout line with parse and sends
+// accepted results to out. A cancelled context stops the process.
+func runTool(ctx context.Context, bin string, args []string, install string, parse func(string) (Result, bool), out chan<- Result) error {
+	// Check if the tool is available
+	if _, err := exec.LookPath(bin); err != nil {
+		if install != "" {
+			return fmt.Errorf("%s not found in PATH: %w\nInstall from: %s", bin, err, install)
+		}
+		return fmt.Errorf("%s not found in PATH: %w", bin, err)
 	}
-	
-	// Create context with timeout (5 minutes)
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
-	defer cancel()
-	
-	// Build command
-	cmd := exec.CommandContext(ctx, "subfinder", "-d", root, "-all", "-silent", "-json")
-	
-	// Get stdout pipe
+
+	cmd := exec.CommandContext(ctx, bin, args...)
+	// Don't wait on grandchildren holding stdout open after a cancel
+	cmd.WaitDelay = time.Second
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get stdout pipe: %w", err)
+		return fmt.Errorf("failed to get stdout pipe: %w", err)
 	}
-	
-	// Start command
+
 	if err := cmd.Start(); err != nil {
-		return nil, fmt.Errorf("failed to start subfinder: %w", err)
+		return fmt.Errorf("failed to start %s: %w", bin, err)
+	}
+
+	// Unblock the reader on cancel even if a grandchild keeps stdout open
+	finished := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			stdout.Close()
+		case <-finished:
+		}
+	}()
+
+	scanErr := streamLines(stdout, parse, out)
+	close(finished)
+	if ctx.Err() != nil {
+		scanErr = nil
+	}
+
+	if err := cmd.Wait(); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("%s failed: %w", bin, err)
+	}
+	if scanErr != nil {
+		return fmt.Errorf("failed to read %s output: %w", bin, scanErr)
 	}
-	
-	// Parse JSON lines
-	seen := make(map[string]bool)
-	scanner := bufio.NewScanner(stdout)
-	
+
+	return nil
+}
+
+// streamLines parses r line by line, forwarding each accepted result.
+func streamLines(r io.Reader, parse func(string) (Result, bool), out chan<- Result) error {
+	scanner := bufio.NewScanner(r)
 	for scanner.Scan() {
 		line := strings.TrimSpace(scanner.Text())
 		if line == "" {
 			continue
 		}
-		
-		var row sfRow
-		if err := json.Unmarshal([]byte(line), &row); err != nil {
-			// Log warning but continue
-			fmt.Printf("Warning: invalid JSON from subfinder: %s\n", line)
+
+		res, ok := parse(line)
+		if !ok || res.Host == "" {
 			continue
 		}
-		
-		// Normalize and deduplicate
-		normalized := util.NormalizeHost(row.Host)
-		if normalized != "" {
-			seen[normalized] = true
-		}
-	}
-	
-	// Wait for command to complete
-	if err := cmd.Wait(); err != nil {
-		return nil, fmt.Errorf("subfinder failed: %w", err)
-	}
-	
-	if err := scanner.Err(); err != nil {
-		return nil, fmt.Errorf("failed to read subfinder output: %w", err)
-	}
-	
-	// Convert to sorted slice
-	var result []string
-	for host := range seen {
-		result = append(result, host)
+		out <- res
 	}
-	
-	return result, nil
+	return scanner.Err()
 }
@@ -0,0 +1,65 @@
+package scan
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// fakeSubfinder installs a shell script named subfinder at the front of PATH.
+func fakeSubfinder(t *testing.T, script string) {
+	if runtime.GOOS == "windows" {
+		t.Skip("shell script stand-in requires a POSIX shell")
+	}
+
+	binDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(binDir, "subfinder"), []byte("#!/bin/sh\n"+script), 0755); err != nil {
+		t.Fatalf("Failed to write fake subfinder: %v", err)
+	}
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestSubfinderStreamsBeforeTimeout(t *testing.T) {
+	fakeSubfinder(t, `echo '{"host":"A.example.com","source":"crtsh"}'
+echo 'not json'
+echo '{"host":"b.example.com","source":"chaos"}'
+sleep 10
+echo '{"host":"late.example.com","source":"crtsh"}'
+`)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	out := make(chan Result, 10)
+	start := time.Now()
+	err := subfinderScanner{}.Run(ctx, "example.com", out)
+	close(out)
+
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected deadline error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected Run to return promptly after the timeout, took %v", elapsed)
+	}
+
+	var got []Result
+	for r := range out {
+		got = append(got, r)
+	}
+	want := []Result{
+		{Host: "a.example.com", Source: "crtsh"},
+		{Host: "b.example.com", Source: "chaos"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Expected %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Expected result[%d] = %+v, got %+v", i, want[i], got[i])
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package scan
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/amoz0x/nether/internal/util"
+)
+
+// tlsTimeout bounds each connection and handshake of the tls scanner.
+const tlsTimeout = 5 * time.Second
+
+// tlsScanner harvests names from the certificates served by known hosts,
+// connecting to every newly found name in turn until no new names appear.
+type tlsScanner struct {
+	opts  Options
+	seeds []string
+	addr  func(hostport string) string // Rewrites dial addresses in tests; nil dials hostport
+}
+
+func (t *tlsScanner) Name() string { return "tls" }
+
+// Seed sets the hosts whose certificates are fetched first.
+func (t *tlsScanner) Seed(hosts []string) { t.seeds = hosts }
+
+// Run connects to the root and the seeded hosts and streams the in-scope
+// certificate names, repeating on the new names found.
+func (t *tlsScanner) Run(ctx context.Context, root string, out chan<- Result) error {
+	visited := make(map[string]bool)
+	var wave []string
+	for _, host := range append([]string{root}, t.seeds...) {
+		if host = util.NormalizeHost(host); host != "" && inScope(host, root) && t.opts.Scope.Allows(host) && !visited[host] {
+			visited[host] = true
+			wave = append(wave, host)
+		}
+	}
+
+	emitted := make(map[string]bool)
+	for len(wave) > 0 && ctx.Err() == nil {
+		var next []string
+		for _, name := range t.harvest(ctx, wave) {
+			if !inScope(name, root) || !t.opts.Scope.Allows(name) {
+				continue
+			}
+			if name != root && !emitted[name] {
+				emitted[name] = true
+				select {
+				case out <- Result{Host: name}:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+			if !visited[name] {
+				visited[name] = true
+				next = append(next, name)
+			}
+		}
+		wave = next
+	}
+
+	return ctx.Err()
+}
+
+// harvest fetches the certificates of hosts with a pool of workers and
+// returns the normalized names they list.
+func (t *tlsScanner) harvest(ctx context.Context, hosts []string) []string {
+	workers := t.opts.Workers
+	if workers <= 0 || workers > 20 {
+		workers = 20
+	}
+	ports := t.opts.TLSPorts
+	if len(ports) == 0 {
+		ports = []int{443}
+	}
+
+	var (
+		mu    sync.Mutex
+		names []string
+		wg    sync.WaitGroup
+	)
+	jobs := make(chan string)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for host := range jobs {
+				for _, port := range ports {
+					found := t.certNames(ctx, host, port)
+					mu.Lock()
+					names = append(names, found...)
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+feed:
+	for _, host := range hosts {
+		select {
+		case jobs <- host:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	return names
+}
+
+// certNames returns the SAN and common names of the leaf certificate served
+// for host on port. Wildcard entries yield the name they are rooted at.
+func (t *tlsScanner) certNames(ctx context.Context, host string, port int) []string {
+	ctx, cancel := context.WithTimeout(ctx, tlsTimeout)
+	defer cancel()
+
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+	if t.addr != nil {
+		addr = t.addr(addr)
+	}
+	// Names are checked before dialing; addresses only once they are known
+	dialer := &net.Dialer{Control: t.opts.Scope.Control}
+	raw, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil
+	}
+	defer raw.Close()
+
+	// Certificates are read, not trusted, so verification is skipped
+	conn := tls.Client(raw, &tls.Config{ServerName: host, InsecureSkipVerify: true})
+	if err := conn.HandshakeContext(ctx); err != nil {
+		return nil
+	}
+	certs := conn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return nil
+	}
+
+	var names []string
+	for _, name := range append([]string{certs[0].Subject.CommonName}, certs[0].DNSNames...) {
+		if name = util.NormalizeHost(strings.TrimPrefix(name, "*.")); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
@@ -0,0 +1,135 @@
+package scan
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/amoz0x/nether/internal/scope"
+)
+
+// selfSigned returns a certificate for the given common name and SANs.
+func selfSigned(t *testing.T, cn string, sans ...string) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: cn},
+		DNSNames:     sans,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// certServer serves certs by SNI name on a local listener and returns its
+// address.
+func certServer(t *testing.T, certs map[string]tls.Certificate) string {
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			cert, ok := certs[hello.ServerName]
+			if !ok {
+				cert = selfSigned(t, "default.invalid")
+			}
+			return &cert, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				conn.(*tls.Conn).Handshake()
+				conn.Close()
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestTLSScannerFollowsSANs(t *testing.T) {
+	// Each SNI name serves its own certificate, so names only show up once
+	// the scanner has connected to the host listing them
+	addr := certServer(t, map[string]tls.Certificate{
+		"example.com":      selfSigned(t, "example.com", "example.com", "www.example.com", "*.dev.example.com", "other.org"),
+		"dev.example.com":  selfSigned(t, "dev.example.com", "deep.dev.example.com"),
+		"seed.example.com": selfSigned(t, "seed.example.com", "seed.example.com", "api.example.com"),
+	})
+
+	scanners, err := Lookup([]string{"tls"}, Options{TLSPorts: []int{443}})
+	if err != nil {
+		t.Fatalf("Failed to build tls scanner: %v", err)
+	}
+	s := scanners[0].(*tlsScanner)
+	s.addr = func(string) string { return addr }
+	s.Seed([]string{"seed.example.com", "unrelated.org"})
+
+	out := make(chan Result)
+	done := make(chan []string)
+	go func() {
+		var found []string
+		for r := range out {
+			found = append(found, r.Host)
+		}
+		done <- found
+	}()
+	errs := RunAll(context.Background(), "example.com", scanners, out)
+	close(out)
+	found := <-done
+
+	if len(errs) != 0 {
+		t.Fatalf("Expected no errors, got %v", errs)
+	}
+	sort.Strings(found)
+	want := []string{"api.example.com", "deep.dev.example.com", "dev.example.com", "seed.example.com", "www.example.com"}
+	if len(found) != len(want) {
+		t.Fatalf("Expected %v, got %v", want, found)
+	}
+	for i := range want {
+		if found[i] != want[i] {
+			t.Errorf("Expected %v, got %v", want, found)
+			break
+		}
+	}
+}
+
+func TestTLSScannerSkipsExcludedAddresses(t *testing.T) {
+	addr := certServer(t, map[string]tls.Certificate{
+		"example.com": selfSigned(t, "example.com", "www.example.com"),
+	})
+	sc, err := scope.Parse(strings.NewReader("!127.0.0.0/8\n"))
+	if err != nil {
+		t.Fatalf("Failed to parse scope: %v", err)
+	}
+
+	// The name is in scope, but the address it dials into is not
+	s := &tlsScanner{opts: Options{Scope: sc}, addr: func(string) string { return addr }}
+	if names := s.certNames(context.Background(), "example.com", 443); len(names) != 0 {
+		t.Errorf("Expected no connection to an excluded address, got %v", names)
+	}
+	s.opts.Scope = nil
+	if names := s.certNames(context.Background(), "example.com", 443); len(names) == 0 {
+		t.Errorf("Expected names without a scope")
+	}
+}
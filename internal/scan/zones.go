@@ -0,0 +1,43 @@
+package scan
+
+import (
+	"sort"
+	"strings"
+)
+
+// DenseZones returns the sub-zones of root exactly labels levels below it
+// that contain at least min known hosts, densest first. They are worth
+// enumerating as roots of their own.
+func DenseZones(root string, hosts []string, labels, min int) []string {
+	if labels <= 0 {
+		return nil
+	}
+
+	counts := make(map[string]int)
+	for _, host := range hosts {
+		if !strings.HasSuffix(host, "."+root) {
+			continue
+		}
+		parts := strings.Split(strings.TrimSuffix(host, "."+root), ".")
+		// The zone needs at least one label of its own below it
+		if len(parts) <= labels {
+			continue
+		}
+		zone := strings.Join(parts[len(parts)-labels:], ".") + "." + root
+		counts[zone]++
+	}
+
+	var zones []string
+	for zone, n := range counts {
+		if n >= min {
+			zones = append(zones, zone)
+		}
+	}
+	sort.Slice(zones, func(i, j int) bool {
+		if counts[zones[i]] != counts[zones[j]] {
+			return counts[zones[i]] > counts[zones[j]]
+		}
+		return zones[i] < zones[j]
+	})
+	return zones
+}
@@ -0,0 +1,24 @@
+package scan
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDenseZones(t *testing.T) {
+	hosts := []string{
+		"a.corp.example.com", "b.corp.example.com", "c.corp.example.com",
+		"x.eu.dev.example.com", "y.eu.dev.example.com", "z.us.dev.example.com",
+		"corp.example.com", "www.example.com", "a.corp.other.org",
+	}
+
+	if got, want := DenseZones("example.com", hosts, 1, 3), []string{"corp.example.com", "dev.example.com"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+	if got, want := DenseZones("example.com", hosts, 2, 2), []string{"eu.dev.example.com"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+	if got := DenseZones("example.com", hosts, 0, 1); got != nil {
+		t.Errorf("Expected no zones at depth 0, got %v", got)
+	}
+}
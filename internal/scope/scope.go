@@ -0,0 +1,337 @@
+// Package scope decides which hosts may be scanned, cached, published and
+// shown, from include and exclude rules such as bug bounty program scopes.
+package scope
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"regexp"
+	"strings"
+	"syscall"
+
+	"github.com/amoz0x/nether/internal/cache"
+	"github.com/amoz0x/nether/internal/util"
+)
+
+// rule is a single scope entry. Exactly one of re and prefix is set.
+type rule struct {
+	re     *regexp.Regexp // Hostname pattern
+	prefix netip.Prefix   // Address range
+}
+
+// Scope holds the include and exclude rules of a scope file. A nil Scope
+// allows everything.
+//
+// A host is out of scope when it matches an exclude pattern or one of its
+// addresses is in an excluded range. Otherwise, when include rules exist, it
+// must match an include pattern or have an address in an included range.
+// Hosts whose addresses are not known yet are only held to the hostname
+// rules, so a scope listing nothing but ranges admits them until resolved.
+type Scope struct {
+	include []rule
+	exclude []rule
+}
+
+// Parse reads a scope file. Each line holds one entry:
+//
+//	example.com             the host itself
+//	*.example.com           any subdomain, at any depth, but not the apex
+//	api-*.example.com       * elsewhere matches within a single label
+//	/^api[0-9]+\.example\.com$/  regular expression over the whole hostname
+//	192.0.2.0/24            addresses in the range; a single IP is a /32
+//	!status.example.com     a leading ! excludes the entry
+//
+// Lines after an [out-of-scope] header are exclusions until an [in-scope]
+// header, so program scope lists can be pasted as is.
+// Blank lines and #-comments are ignored.
+func Parse(r io.Reader) (*Scope, error) {
+	s := &Scope{}
+	exclude := false
+
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		switch strings.ToLower(line) {
+		case "[in-scope]", "[include]":
+			exclude = false
+			continue
+		case "[out-of-scope]", "[exclude]":
+			exclude = true
+			continue
+		}
+
+		negated := exclude
+		if strings.HasPrefix(line, "!") {
+			negated = true
+			line = strings.TrimSpace(line[1:])
+		}
+		r, err := parseRule(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		if negated {
+			s.exclude = append(s.exclude, r)
+		} else {
+			s.include = append(s.include, r)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read scope: %w", err)
+	}
+	return s, nil
+}
+
+// Load reads the scope file at path.
+func Load(path string) (*Scope, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open scope file: %w", err)
+	}
+	defer file.Close()
+
+	s, err := Parse(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return s, nil
+}
+
+// ForRoot returns the scope of root: the project scope file set on the cache
+// combined with the root's own scope file, if either exists. It returns nil
+// when neither does.
+func ForRoot(c *cache.Cache, root string) (*Scope, error) {
+	var paths []string
+	if c.ScopeFile != "" {
+		paths = append(paths, c.ScopeFile)
+	}
+	if path := c.ScopePath(root); fileExists(path) {
+		paths = append(paths, path)
+	}
+
+	var merged *Scope
+	for _, path := range paths {
+		s, err := Load(path)
+		if err != nil {
+			return nil, err
+		}
+		merged = merged.Merge(s)
+	}
+	return merged, nil
+}
+
+// Merge returns a scope holding the rules of both s and other.
+func (s *Scope) Merge(other *Scope) *Scope {
+	if s == nil {
+		return other
+	}
+	if other == nil {
+		return s
+	}
+	return &Scope{
+		include: append(append([]rule(nil), s.include...), other.include...),
+		exclude: append(append([]rule(nil), s.exclude...), other.exclude...),
+	}
+}
+
+// Allows reports whether host is in scope, judging by its name alone.
+func (s *Scope) Allows(host string) bool {
+	return s.Check(host, nil)
+}
+
+// AllowsAddr reports whether addr is outside every excluded range, so it may
+// be contacted.
+func (s *Scope) AllowsAddr(addr netip.Addr) bool {
+	if s == nil {
+		return true
+	}
+	for _, r := range s.exclude {
+		if r.matchAddr(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// ErrOutOfScope is returned by Control for addresses in excluded ranges.
+var ErrOutOfScope = errors.New("address is out of scope")
+
+// Control is a net.Dialer Control function refusing connections to addresses
+// in excluded ranges. Checking at dial time catches hosts whose cached
+// records are missing or out of date.
+func (s *Scope) Control(network, address string, _ syscall.RawConn) error {
+	ap, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("invalid dial address %q: %w", address, err)
+	}
+	if !s.AllowsAddr(ap.Addr().Unmap()) {
+		return fmt.Errorf("%w: %s", ErrOutOfScope, ap.Addr())
+	}
+	return nil
+}
+
+// AllowsRow reports whether row is in scope, judging by its name and the
+// addresses it last resolved to.
+func (s *Scope) AllowsRow(row cache.Row) bool {
+	if s == nil {
+		return true
+	}
+	var addrs []string
+	if row.DNS != nil {
+		addrs = append(append(addrs, row.DNS.A...), row.DNS.AAAA...)
+	}
+	return s.Check(row.Sub, addrs)
+}
+
+// Check reports whether host, known to resolve to addrs, is in scope.
+func (s *Scope) Check(host string, addrs []string) bool {
+	if s == nil {
+		return true
+	}
+
+	var parsed []netip.Addr
+	for _, a := range addrs {
+		if addr, err := netip.ParseAddr(a); err == nil {
+			parsed = append(parsed, addr.Unmap())
+		}
+	}
+
+	for _, r := range s.exclude {
+		if r.matchHost(host) {
+			return false
+		}
+		for _, addr := range parsed {
+			if r.matchAddr(addr) {
+				return false
+			}
+		}
+	}
+	if len(s.include) == 0 {
+		return true
+	}
+
+	hostRules := false
+	for _, r := range s.include {
+		if r.re != nil {
+			hostRules = true
+		}
+		if r.matchHost(host) {
+			return true
+		}
+		for _, addr := range parsed {
+			if r.matchAddr(addr) {
+				return true
+			}
+		}
+	}
+	return !hostRules && len(parsed) == 0
+}
+
+// Filter returns the hosts in scope, judging by name alone.
+func (s *Scope) Filter(hosts []string) []string {
+	if s == nil {
+		return hosts
+	}
+	var kept []string
+	for _, host := range hosts {
+		if s.Allows(host) {
+			kept = append(kept, host)
+		}
+	}
+	return kept
+}
+
+// FilterRows returns the rows in scope.
+func (s *Scope) FilterRows(rows []cache.Row) []cache.Row {
+	if s == nil {
+		return rows
+	}
+	var kept []cache.Row
+	for _, row := range rows {
+		if s.AllowsRow(row) {
+			kept = append(kept, row)
+		}
+	}
+	return kept
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func (r rule) matchHost(host string) bool {
+	return r.re != nil && r.re.MatchString(host)
+}
+
+func (r rule) matchAddr(addr netip.Addr) bool {
+	return r.prefix.IsValid() && r.prefix.Contains(addr)
+}
+
+// parseRule parses a single entry, without its ! prefix.
+func parseRule(text string) (rule, error) {
+	var r rule
+
+	if len(text) > 1 && strings.HasPrefix(text, "/") && strings.HasSuffix(text, "/") {
+		re, err := regexp.Compile(text[1 : len(text)-1])
+		if err != nil {
+			return r, fmt.Errorf("invalid regular expression %s: %w", text, err)
+		}
+		r.re = re
+		return r, nil
+	}
+
+	if prefix, err := netip.ParsePrefix(text); err == nil {
+		r.prefix = prefix.Masked()
+		return r, nil
+	}
+	if addr, err := netip.ParseAddr(text); err == nil {
+		addr = addr.Unmap()
+		r.prefix = netip.PrefixFrom(addr, addr.BitLen())
+		return r, nil
+	}
+
+	host := strings.TrimSuffix(strings.ToLower(text), ".")
+	if host == "" || strings.ContainsAny(host, " /:") {
+		return r, fmt.Errorf("invalid entry %q", text)
+	}
+
+	// Hosts are matched in punycode, so Unicode labels are converted too
+	labels := strings.Split(host, ".")
+	for i, label := range labels {
+		if strings.Contains(label, "*") {
+			continue
+		}
+		ascii, err := util.ToASCII(label)
+		if err != nil {
+			return r, fmt.Errorf("invalid entry %q: %w", text, err)
+		}
+		labels[i] = ascii
+	}
+	host = strings.Join(labels, ".")
+	r.re = regexp.MustCompile("^" + globPattern(host) + "$")
+	return r, nil
+}
+
+// globPattern converts a hostname glob to a regular expression. A leading
+// "*." stands for one or more labels, any other * for part of a label.
+func globPattern(glob string) string {
+	var sb strings.Builder
+	if strings.HasPrefix(glob, "*.") {
+		sb.WriteString(`(?:[^.]+\.)+`)
+		glob = glob[2:]
+	}
+	for i, part := range strings.Split(glob, "*") {
+		if i > 0 {
+			sb.WriteString(`[^.]*`)
+		}
+		sb.WriteString(regexp.QuoteMeta(part))
+	}
+	return sb.String()
+}
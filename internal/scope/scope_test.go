@@ -0,0 +1,92 @@
+package scope
+
+import (
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/amoz0x/nether/internal/cache"
+)
+
+func TestScopeRules(t *testing.T) {
+	s, err := Parse(strings.NewReader(`
+# Program scope
+*.example.com
+example.com
+/^api[0-9]+\.example\.org$/
+198.51.100.0/24
+!status.example.com
+!*.corp.example.com
+!bücher.example.com
+
+[out-of-scope]
+legacy-*.example.com
+192.0.2.66
+`))
+	if err != nil {
+		t.Fatalf("Failed to parse scope: %v", err)
+	}
+
+	tests := []struct {
+		host  string
+		addrs []string
+		want  bool
+	}{
+		{"example.com", nil, true},
+		{"www.example.com", nil, true},
+		{"a.b.example.com", nil, true},
+		{"status.example.com", nil, false},
+		{"corp.example.com", nil, true},
+		{"vpn.corp.example.com", nil, false},
+		{"legacy-app.example.com", nil, false},
+		{"legacy.app.example.com", nil, true},
+		{"api12.example.org", nil, true},
+		{"www.example.org", nil, false},
+		{"www.example.org", []string{"198.51.100.7"}, true},
+		{"www.example.com", []string{"192.0.2.66"}, false},
+		{"www.example.com", []string{"::ffff:192.0.2.66"}, false},
+		{"notexample.com", nil, false},
+		{"xn--bcher-kva.example.com", nil, false},
+	}
+	for _, tt := range tests {
+		if got := s.Check(tt.host, tt.addrs); got != tt.want {
+			t.Errorf("Check(%q, %v) = %v, want %v", tt.host, tt.addrs, got, tt.want)
+		}
+	}
+
+	if s.AllowsAddr(netip.MustParseAddr("192.0.2.66")) {
+		t.Errorf("Expected excluded address to be refused")
+	}
+	row := cache.Row{Sub: "www.example.com", DNS: &cache.Records{A: []string{"192.0.2.66"}}}
+	if s.AllowsRow(row) {
+		t.Errorf("Expected row resolving into an excluded range to be out of scope")
+	}
+}
+
+func TestScopeRangesOnly(t *testing.T) {
+	s, err := Parse(strings.NewReader("192.0.2.0/24\n"))
+	if err != nil {
+		t.Fatalf("Failed to parse scope: %v", err)
+	}
+
+	// Unresolved hosts can't be judged yet and are kept
+	if !s.Allows("www.example.com") {
+		t.Errorf("Expected unresolved host to be allowed")
+	}
+	if s.Check("www.example.com", []string{"203.0.113.1"}) {
+		t.Errorf("Expected host outside the range to be out of scope")
+	}
+
+	var none *Scope
+	if !none.Allows("anything.example.com") || len(none.Filter([]string{"a"})) != 1 {
+		t.Errorf("Expected a nil scope to allow everything")
+	}
+}
+
+func TestParseRejectsBadEntries(t *testing.T) {
+	for _, input := range []string{"/[/\n", "http://example.com\n", "!\n"} {
+		if _, err := Parse(strings.NewReader(input)); err == nil {
+			t.Errorf("Expected error for %q", input)
+		}
+	}
+}
@@ -0,0 +1,251 @@
+// Package takeover flags subdomains whose CNAME points at an unclaimed
+// third-party service.
+package takeover
+
+import (
+	"context"
+	"crypto/tls"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/amoz0x/nether/internal/cache"
+	"github.com/amoz0x/nether/internal/scope"
+)
+
+// Kind is the finding kind recorded for takeover candidates.
+const Kind = "takeover"
+
+// maxBody bounds how much of a response is searched for fingerprints.
+const maxBody = 1 << 20
+
+//go:embed fingerprints.json
+var defaultFingerprints []byte
+
+// DefaultFingerprints returns the bundled fingerprint file, for users who
+// want to start their own from it.
+func DefaultFingerprints() []byte {
+	return defaultFingerprints
+}
+
+// Fingerprint describes how an unclaimed resource of a service looks.
+type Fingerprint struct {
+	Service     string   `json:"service"`
+	CNAME       []string `json:"cname"`                 // Glob patterns; plain domains also match their subdomains
+	Fingerprint []string `json:"fingerprint,omitempty"` // Body snippets served for unclaimed resources
+	NXDomain    bool     `json:"nxdomain,omitempty"`    // A CNAME target that doesn't resolve is claimable
+}
+
+// Matches reports whether a CNAME target belongs to the service.
+func (f Fingerprint) Matches(target string) bool {
+	target = strings.ToLower(strings.TrimSuffix(target, "."))
+	for _, pattern := range f.CNAME {
+		pattern = strings.ToLower(pattern)
+		if strings.Contains(pattern, "*") {
+			if ok, _ := path.Match(pattern, target); ok {
+				return true
+			}
+			continue
+		}
+		if target == pattern || strings.HasSuffix(target, "."+pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseFingerprints decodes and validates a fingerprint file.
+func ParseFingerprints(data []byte) ([]Fingerprint, error) {
+	var fps []Fingerprint
+	if err := json.Unmarshal(data, &fps); err != nil {
+		return nil, fmt.Errorf("invalid fingerprint file: %w", err)
+	}
+	for i, fp := range fps {
+		if fp.Service == "" || len(fp.CNAME) == 0 {
+			return nil, fmt.Errorf("invalid fingerprint #%d: service and cname are required", i+1)
+		}
+		if !fp.NXDomain && len(fp.Fingerprint) == 0 {
+			return nil, fmt.Errorf("invalid fingerprint for %s: needs nxdomain or a body fingerprint", fp.Service)
+		}
+		for _, pattern := range fp.CNAME {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("invalid cname pattern %q for %s: %w", pattern, fp.Service, err)
+			}
+		}
+	}
+	return fps, nil
+}
+
+// LoadFingerprints reads the fingerprint file at path, or the bundled one
+// when path is empty.
+func LoadFingerprints(path string) ([]Fingerprint, error) {
+	if path == "" {
+		return ParseFingerprints(defaultFingerprints)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fingerprints: %w", err)
+	}
+	return ParseFingerprints(data)
+}
+
+// Fetcher returns the body served for host over HTTP(S).
+type Fetcher func(ctx context.Context, host string) (string, error)
+
+// HTTPFetcher fetches https://host/ and falls back to plain HTTP. Certificates
+// are not verified since unclaimed resources rarely serve a matching one.
+// Connections into ranges excluded by sc are refused.
+func HTTPFetcher(timeout time.Duration, sc *scope.Scope) Fetcher {
+	client := &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext:     (&net.Dialer{Timeout: timeout, Control: sc.Control}).DialContext,
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+	}
+
+	return func(ctx context.Context, host string) (string, error) {
+		var lastErr error
+		for _, scheme := range []string{"https", "http"} {
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, scheme+"://"+host+"/", nil)
+			if err != nil {
+				return "", err
+			}
+			resp, err := client.Do(req)
+			if err != nil {
+				lastErr = err
+				continue
+			}
+			body, err := io.ReadAll(io.LimitReader(resp.Body, maxBody))
+			resp.Body.Close()
+			if err != nil {
+				lastErr = err
+				continue
+			}
+			return string(body), nil
+		}
+		return "", lastErr
+	}
+}
+
+// Checker matches resolved rows against fingerprints.
+type Checker struct {
+	Fingerprints []Fingerprint
+	Fetch        Fetcher
+	Workers      int
+}
+
+// NewChecker returns a checker that fetches bodies over HTTP(S).
+func NewChecker(fps []Fingerprint) *Checker {
+	return &Checker{
+		Fingerprints: fps,
+		Fetch:        HTTPFetcher(10*time.Second, nil),
+		Workers:      10,
+	}
+}
+
+// Check returns the takeover finding for row, or nil. Rows must have been
+// resolved; the CNAME chain is matched from its final target backwards.
+func (c *Checker) Check(ctx context.Context, row cache.Row) *cache.Finding {
+	rec := row.DNS
+	if rec == nil || len(rec.CNAME) == 0 {
+		return nil
+	}
+
+	for i := len(rec.CNAME) - 1; i >= 0; i-- {
+		target := rec.CNAME[i]
+		for _, fp := range c.Fingerprints {
+			if !fp.Matches(target) {
+				continue
+			}
+
+			finding := &cache.Finding{
+				Kind:       Kind,
+				Service:    fp.Service,
+				Target:     target,
+				DetectedAt: time.Now().UTC().Format(time.RFC3339),
+			}
+			if rec.NXDomain {
+				if !fp.NXDomain {
+					return nil
+				}
+				finding.Evidence = "CNAME target does not resolve (NXDOMAIN)"
+				return finding
+			}
+			if len(fp.Fingerprint) == 0 || c.Fetch == nil {
+				return nil
+			}
+
+			body, err := c.Fetch(ctx, row.Sub)
+			if err != nil {
+				return nil
+			}
+			for _, snippet := range fp.Fingerprint {
+				if strings.Contains(body, snippet) {
+					finding.Evidence = fmt.Sprintf("response contains %q", snippet)
+					return finding
+				}
+			}
+			return nil
+		}
+	}
+	return nil
+}
+
+// CheckAll checks rows with a pool of workers. It returns the hosts that
+// could be checked, that is those with DNS records, and the findings by host.
+func (c *Checker) CheckAll(ctx context.Context, rows []cache.Row) (map[string]bool, map[string][]cache.Finding) {
+	workers := c.Workers
+	if workers <= 0 {
+		workers = 10
+	}
+
+	checked := make(map[string]bool)
+	findings := make(map[string][]cache.Finding)
+	var mu sync.Mutex
+
+	jobs := make(chan cache.Row)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for row := range jobs {
+				finding := c.Check(ctx, row)
+				if ctx.Err() != nil {
+					continue // Don't clear findings on an interrupted check
+				}
+				mu.Lock()
+				checked[row.Sub] = true
+				if finding != nil {
+					findings[row.Sub] = append(findings[row.Sub], *finding)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+feed:
+	for _, row := range rows {
+		if row.DNS == nil {
+			continue
+		}
+		select {
+		case jobs <- row:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	return checked, findings
+}
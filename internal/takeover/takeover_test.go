@@ -0,0 +1,94 @@
+package takeover
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/amoz0x/nether/internal/cache"
+)
+
+func TestBundledFingerprintsParse(t *testing.T) {
+	fps, err := LoadFingerprints("")
+	if err != nil {
+		t.Fatalf("Bundled fingerprints are invalid: %v", err)
+	}
+
+	matches := map[string]string{
+		"assets.s3.amazonaws.com":                 "AWS S3",
+		"site.s3-website-us-east-1.amazonaws.com": "AWS S3",
+		"org.github.io.":                          "GitHub Pages",
+		"app.azurewebsites.net":                   "Microsoft Azure",
+		"env.eu-west-1.elasticbeanstalk.com":      "AWS Elastic Beanstalk",
+		"notgithub.io":                            "",
+		"github.io.example.com":                   "",
+	}
+	for target, want := range matches {
+		got := ""
+		for _, fp := range fps {
+			if fp.Matches(target) {
+				got = fp.Service
+				break
+			}
+		}
+		if got != want {
+			t.Errorf("Expected %s to match %q, got %q", target, want, got)
+		}
+	}
+}
+
+func TestParseFingerprintsRejectsIncomplete(t *testing.T) {
+	if _, err := ParseFingerprints([]byte(`[{"service":"X","cname":["x.com"]}]`)); err == nil {
+		t.Errorf("Expected error for a fingerprint without nxdomain or body snippets")
+	}
+	if _, err := ParseFingerprints([]byte(`[{"service":"X","cname":["[x"],"nxdomain":true}]`)); err == nil {
+		t.Errorf("Expected error for a malformed cname pattern")
+	}
+}
+
+func TestCheckAll(t *testing.T) {
+	fps, err := ParseFingerprints([]byte(`[
+		{"service": "Pages", "cname": ["pages.example.net"], "fingerprint": ["no site here"]},
+		{"service": "Cloud", "cname": ["*.cloud.example.org"], "nxdomain": true}
+	]`))
+	if err != nil {
+		t.Fatalf("Failed to parse fingerprints: %v", err)
+	}
+
+	bodies := map[string]string{
+		"docs.example.com": "<h1>no site here</h1>",
+		"blog.example.com": "welcome to the blog",
+	}
+	c := &Checker{
+		Fingerprints: fps,
+		Fetch: func(ctx context.Context, host string) (string, error) {
+			if body, ok := bodies[host]; ok {
+				return body, nil
+			}
+			return "", errors.New("connection refused")
+		},
+	}
+
+	rows := []cache.Row{
+		{Sub: "docs.example.com", DNS: &cache.Records{CNAME: []string{"org.pages.example.net"}, A: []string{"192.0.2.1"}}},
+		{Sub: "blog.example.com", DNS: &cache.Records{CNAME: []string{"blog.pages.example.net"}, A: []string{"192.0.2.1"}}},
+		{Sub: "app.example.com", DNS: &cache.Records{CNAME: []string{"lb.example.com", "app.east.cloud.example.org"}, NXDomain: true}},
+		{Sub: "www.example.com", DNS: &cache.Records{A: []string{"192.0.2.2"}}},
+		{Sub: "new.example.com"}, // Never resolved
+	}
+
+	checked, findings := c.CheckAll(context.Background(), rows)
+
+	if len(checked) != 4 || checked["new.example.com"] {
+		t.Errorf("Expected the 4 resolved hosts to be checked, got %v", checked)
+	}
+	if len(findings) != 2 {
+		t.Fatalf("Expected 2 hosts with findings, got %v", findings)
+	}
+	if f := findings["docs.example.com"]; len(f) != 1 || f[0].Service != "Pages" || f[0].Kind != Kind {
+		t.Errorf("Expected a Pages finding for docs, got %+v", f)
+	}
+	if f := findings["app.example.com"]; len(f) != 1 || f[0].Service != "Cloud" || f[0].Target != "app.east.cloud.example.org" {
+		t.Errorf("Expected a Cloud finding for app, got %+v", f)
+	}
+}
@@ -0,0 +1,64 @@
+package util
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// WriteAtomic replaces the file at path with what fn writes. The content goes
+// to a temporary file in the same directory that is synced and renamed over
+// path only once fn succeeds, so readers and crashes see either the old file
+// or the complete new one.
+func WriteAtomic(path string, fn func(w io.Writer) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // No-op after a successful rename
+
+	if err := fn(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// WriteFileAtomic replaces the file at path with data, see WriteAtomic.
+func WriteFileAtomic(path string, data []byte) error {
+	return WriteAtomic(path, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
+
+// WriteZstAtomic replaces the file at path with the zstd-compressed form of
+// what fn writes, see WriteAtomic.
+func WriteZstAtomic(path string, fn func(w io.Writer) error) error {
+	return WriteAtomic(path, func(w io.Writer) error {
+		enc, err := NewZstWriter(w)
+		if err != nil {
+			return err
+		}
+		if err := fn(enc); err != nil {
+			enc.Close()
+			return err
+		}
+		if err := enc.Close(); err != nil {
+			return fmt.Errorf("failed to finish zstd frame: %w", err)
+		}
+		return nil
+	})
+}
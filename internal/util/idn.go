@@ -0,0 +1,98 @@
+package util
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/idna"
+)
+
+// ToASCII converts a hostname to its canonical ASCII form, encoding Unicode
+// labels as punycode (xn--) after IDNA mapping. ASCII hostnames without xn--
+// labels are returned unchanged.
+func ToASCII(host string) (string, error) {
+	if isASCII(host) && !strings.Contains(host, "xn--") {
+		return host, nil
+	}
+	return idna.Lookup.ToASCII(host)
+}
+
+// ToUnicode returns the Unicode form of a hostname for display, decoding
+// punycode labels. Hostnames that fail to decode are returned unchanged.
+func ToUnicode(host string) string {
+	if !strings.Contains(host, "xn--") {
+		return host
+	}
+	u, err := idna.Lookup.ToUnicode(host)
+	if err != nil {
+		return host
+	}
+	return u
+}
+
+// scripts are the writing systems told apart by Homograph. Characters in
+// none of them, such as digits and hyphens, are ignored.
+var scripts = []*unicode.RangeTable{
+	unicode.Latin, unicode.Cyrillic, unicode.Greek, unicode.Armenian,
+	unicode.Hebrew, unicode.Arabic, unicode.Devanagari, unicode.Thai,
+	unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul,
+}
+
+// latinLookalikes are Cyrillic and Greek letters rendered like Latin ones.
+const latinLookalikes = "аеорсухіјѕԁһӏԛԝαικνορυχ"
+
+// Homograph reports whether a label of host looks crafted to imitate another
+// name: it mixes scripts, such as Latin with Cyrillic, or is written only in
+// Cyrillic or Greek letters that look like Latin ones. The suspicious label
+// is returned in Unicode form. Han mixed with Japanese kana or Hangul is
+// ordinary and not reported.
+func Homograph(host string) (string, bool) {
+	for _, label := range strings.Split(ToUnicode(host), ".") {
+		if isASCII(label) {
+			continue
+		}
+
+		used := make(map[*unicode.RangeTable]bool)
+		lookalike := true
+		for _, r := range label {
+			script := scriptOf(r)
+			if script == nil {
+				continue
+			}
+			used[script] = true
+			if !strings.ContainsRune(latinLookalikes, r) {
+				lookalike = false
+			}
+		}
+
+		cjk := 0
+		for _, t := range []*unicode.RangeTable{unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul} {
+			if used[t] {
+				cjk++
+			}
+		}
+		mixed := len(used) > 1 && cjk != len(used)
+		if mixed || (len(used) == 1 && (used[unicode.Cyrillic] || used[unicode.Greek]) && lookalike) {
+			return label, true
+		}
+	}
+	return "", false
+}
+
+func scriptOf(r rune) *unicode.RangeTable {
+	for _, t := range scripts {
+		if unicode.Is(t, r) {
+			return t
+		}
+	}
+	return nil
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,43 @@
+package util
+
+import "testing"
+
+func TestToUnicodeRoundTrip(t *testing.T) {
+	host, err := ToASCII("bücher.例え.example.com")
+	if err != nil {
+		t.Fatalf("Failed to convert to ASCII: %v", err)
+	}
+	if want := "xn--bcher-kva.xn--r8jz45g.example.com"; host != want {
+		t.Errorf("Expected %s, got %s", want, host)
+	}
+	if got := ToUnicode(host); got != "bücher.例え.example.com" {
+		t.Errorf("Expected round trip to Unicode, got %s", got)
+	}
+	if got := ToUnicode("api.example.com"); got != "api.example.com" {
+		t.Errorf("Expected ASCII host unchanged, got %s", got)
+	}
+}
+
+func TestHomograph(t *testing.T) {
+	tests := []struct {
+		host  string
+		label string
+		want  bool
+	}{
+		{"аpple.example.com", "аpple", true},          // Cyrillic а with Latin
+		{"аррӏе.example.com", "аррӏе", true},          // All Cyrillic lookalikes
+		{"xn--80ak6aa92e.example.com", "аррӏе", true}, // Same, as punycode
+		{"bücher.example.com", "", false},
+		{"日本語.example.com", "", false},
+		{"東京タワー.example.com", "", false},
+		{"москва.example.com", "", false},
+		{"api.example.com", "", false},
+	}
+
+	for _, tt := range tests {
+		label, got := Homograph(tt.host)
+		if got != tt.want || label != tt.label {
+			t.Errorf("Homograph(%q) = %q, %v; expected %q, %v", tt.host, label, got, tt.label, tt.want)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package util
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrLockTimeout is returned by Lock when another process holds the lock
+// for longer than the timeout.
+var ErrLockTimeout = errors.New("timed out waiting for lock")
+
+// lockPoll is how often Lock retries a held lock.
+const lockPoll = 25 * time.Millisecond
+
+// Lock takes an advisory lock on the lock file at path, creating it if
+// needed, and returns the function that releases it. Exclusive locks exclude
+// every other lock on the file; shared locks only exclusive ones. Lock waits
+// up to timeout for locks held by other processes or other calls in this one.
+func Lock(path string, exclusive bool, timeout time.Duration) (func(), error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		release, err := tryLock(path, exclusive)
+		if err != nil || release != nil {
+			return release, err
+		}
+		if time.Now().After(deadline) {
+			return nil, ErrLockTimeout
+		}
+		time.Sleep(lockPoll)
+	}
+}
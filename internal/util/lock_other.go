@@ -0,0 +1,31 @@
+//go:build !unix
+
+package util
+
+import (
+	"os"
+	"time"
+)
+
+// staleLock is the age after which a lock file left by a crashed process is
+// taken over.
+const staleLock = 10 * time.Minute
+
+// tryLock takes the lock by creating path exclusively, without waiting. It
+// returns a nil release function if the lock is held elsewhere. Without
+// flock there are no shared locks, so every lock is exclusive.
+func tryLock(path string, exclusive bool) (func(), error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if os.IsExist(err) {
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > staleLock {
+			os.Remove(path)
+		}
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	file.Close()
+
+	return func() { os.Remove(path) }, nil
+}
@@ -0,0 +1,63 @@
+package util
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLockExcludesWriters(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "root.lock")
+
+	release, err := Lock(path, true, time.Second)
+	if err != nil {
+		t.Fatalf("Failed to lock: %v", err)
+	}
+	if _, err := Lock(path, true, 50*time.Millisecond); !errors.Is(err, ErrLockTimeout) {
+		t.Fatalf("Expected a held lock to time out, got %v", err)
+	}
+
+	// The lock is granted once released
+	done := make(chan error)
+	go func() {
+		r, err := Lock(path, true, time.Second)
+		if err == nil {
+			r()
+		}
+		done <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	release()
+	if err := <-done; err != nil {
+		t.Fatalf("Expected the lock after release, got %v", err)
+	}
+}
+
+func TestWriteAtomicKeepsOldFileOnError(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "data.json")
+	if err := WriteFileAtomic(path, []byte("old")); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+
+	failed := errors.New("interrupted")
+	err := WriteAtomic(path, func(w io.Writer) error {
+		w.Write([]byte("partial"))
+		return failed
+	})
+	if !errors.Is(err, failed) {
+		t.Fatalf("Expected the write error, got %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil || string(data) != "old" {
+		t.Errorf("Expected the old content to survive, got %q (%v)", data, err)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("Expected the temporary file to be removed, got %d files", len(entries))
+	}
+}
@@ -0,0 +1,33 @@
+//go:build unix
+
+package util
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// tryLock takes a flock(2) lock on path without waiting. It returns a nil
+// release function if the lock is held elsewhere.
+func tryLock(path string, exclusive bool) (func(), error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	how := syscall.LOCK_SH
+	if exclusive {
+		how = syscall.LOCK_EX
+	}
+	if err := syscall.Flock(int(file.Fd()), how|syscall.LOCK_NB); err != nil {
+		file.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	// Closing the file releases the lock
+	return func() { file.Close() }, nil
+}
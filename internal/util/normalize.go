@@ -2,32 +2,78 @@
 package util
 
 import (
+	"net"
 	"regexp"
 	"strings"
 )
 
-var validFQDNPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9\-]{0,61}[a-z0-9])?(\.[a-z0-9]([a-z0-9\-]{0,61}[a-z0-9])?)*\.?$`)
+var validFQDNPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9\-]{0,61}[a-z0-9])?(\.[a-z0-9]([a-z0-9\-]{0,61}[a-z0-9])?)*$`)
 
-// NormalizeHost normalizes a hostname by trimming whitespace, converting to lowercase,
-// and performing basic validation.
-func NormalizeHost(s string) string {
-	// Trim spaces and convert to lowercase
+// Reason explains why a hostname was rejected.
+type Reason string
+
+// Rejection reasons reported by CheckHost.
+const (
+	ReasonInvalidLabel Reason = "invalid label"
+	ReasonTooLong      Reason = "too long"
+	ReasonOutOfScope   Reason = "out of scope"
+	ReasonWildcard     Reason = "wildcard prefix"
+	ReasonTrailingDot  Reason = "trailing dot"
+	ReasonIPLiteral    Reason = "IP literal"
+	ReasonOtherDomain  Reason = "other registrable domain"
+)
+
+// CleanHost fixes what can be fixed in a reported hostname without
+// validating it: surrounding whitespace and upper case are removed, as are a
+// single trailing dot and a leading "*." wildcard label.
+func CleanHost(s string) string {
 	s = strings.ToLower(strings.TrimSpace(s))
-	
-	// Reject empty strings
-	if s == "" {
-		return ""
+	s = strings.TrimSuffix(s, ".")
+	return strings.TrimPrefix(s, "*.")
+}
+
+// CheckHost cleans s with CleanHost, converts Unicode labels to punycode and
+// validates the result. When root is not empty the host must also be root or
+// one of its subdomains, and not fall under a public suffix below root that
+// makes it a registrable domain of its own. It returns the normalized hostname, or an empty
+// string and the reason it was rejected.
+func CheckHost(s, root string) (string, Reason) {
+	host := CleanHost(s)
+
+	switch {
+	case host == "":
+		return "", ReasonInvalidLabel
+	case strings.HasSuffix(host, "."):
+		return "", ReasonTrailingDot
+	case strings.Contains(host, "*"):
+		return "", ReasonWildcard
+	case net.ParseIP(strings.Trim(host, "[]")) != nil:
+		return "", ReasonIPLiteral
 	}
-	
-	// Reject overly long hostnames (DNS label limit is 63 chars, total limit is 253)
-	if len(s) > 253 {
-		return s // Keep as-is but likely invalid
+
+	host, err := ToASCII(host)
+	if err != nil {
+		return "", ReasonInvalidLabel
 	}
-	
-	// Check if it matches basic FQDN pattern
-	if !validFQDNPattern.MatchString(s) {
-		return s // Keep as-is but likely invalid
+
+	switch {
+	case len(host) > 253:
+		return "", ReasonTooLong
+	case !validFQDNPattern.MatchString(host):
+		return "", ReasonInvalidLabel
+	case root != "" && host != root && !strings.HasSuffix(host, "."+root):
+		return "", ReasonOutOfScope
+	case root != "" && crossesDomain(host, root):
+		return "", ReasonOtherDomain
 	}
-	
-	return s
+	return host, ""
+}
+
+// NormalizeHost normalizes a hostname by trimming whitespace, converting to
+// lowercase, stripping a trailing dot or leading "*." label and encoding
+// Unicode labels as punycode. Hostnames that are still invalid afterwards
+// yield an empty string.
+func NormalizeHost(s string) string {
+	host, _ := CheckHost(s, "")
+	return host
 }
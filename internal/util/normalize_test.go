@@ -0,0 +1,46 @@
+package util
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckHost(t *testing.T) {
+	tests := []struct {
+		in     string
+		root   string
+		want   string
+		reason Reason
+	}{
+		{" API.Example.com ", "example.com", "api.example.com", ""},
+		{"www.example.com.", "example.com", "www.example.com", ""},
+		{"*.dev.example.com", "example.com", "dev.example.com", ""},
+		{"example.com", "example.com", "example.com", ""},
+		{"www.example.com..", "example.com", "", ReasonTrailingDot},
+		{"a.*.example.com", "example.com", "", ReasonWildcard},
+		{"192.0.2.1", "", "", ReasonIPLiteral},
+		{"[2001:db8::1]", "", "", ReasonIPLiteral},
+		{strings.Repeat("a.", 130) + "example.com", "", "", ReasonTooLong},
+		{"bad_label.example.com", "example.com", "", ReasonInvalidLabel},
+		{"-dash.example.com", "example.com", "", ReasonInvalidLabel},
+		{strings.Repeat("a", 64) + ".example.com", "", "", ReasonInvalidLabel},
+		{"", "", "", ReasonInvalidLabel},
+		{"www.example.net", "example.com", "", ReasonOutOfScope},
+		{"notexample.com", "example.com", "", ReasonOutOfScope},
+		{"Bücher.example.com", "example.com", "xn--bcher-kva.example.com", ""},
+		{"xn--bcher-kva.example.com", "example.com", "xn--bcher-kva.example.com", ""},
+		{"bucket.s3.amazonaws.com", "amazonaws.com", "", ReasonOtherDomain},
+		{"s3.amazonaws.com", "amazonaws.com", "s3.amazonaws.com", ""},
+		{"www.example.co.uk", "example.co.uk", "www.example.co.uk", ""},
+	}
+	for _, tt := range tests {
+		got, reason := CheckHost(tt.in, tt.root)
+		if got != tt.want || reason != tt.reason {
+			t.Errorf("CheckHost(%q, %q) = %q, %q; want %q, %q", tt.in, tt.root, got, reason, tt.want, tt.reason)
+		}
+	}
+
+	if got := NormalizeHost("bad_label.example.com"); got != "" {
+		t.Errorf("Expected invalid host to normalize to empty, got %q", got)
+	}
+}
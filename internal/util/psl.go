@@ -0,0 +1,32 @@
+package util
+
+import (
+	"fmt"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// Registrable returns the registrable domain (eTLD+1) of host according to
+// the Public Suffix List compiled into the binary, such as example.co.uk for
+// www.example.co.uk. Private suffixes count, so each bucket.s3.amazonaws.com
+// is a registrable domain of its own. Public suffixes themselves, such as
+// co.uk or github.io, have none and yield an error.
+func Registrable(host string) (string, error) {
+	domain, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		return "", fmt.Errorf("%s is a public suffix, not a registrable domain", host)
+	}
+	return domain, nil
+}
+
+// crossesDomain reports whether host belongs to a different registrable
+// domain than root, as bucket.s3.amazonaws.com does for amazonaws.com. Roots
+// and hosts that are public suffixes themselves are not judged.
+func crossesDomain(host, root string) bool {
+	want, err := Registrable(root)
+	if err != nil {
+		return false
+	}
+	got, err := Registrable(host)
+	return err == nil && got != want
+}
@@ -0,0 +1,33 @@
+package util
+
+import "testing"
+
+func TestRegistrable(t *testing.T) {
+	tests := []struct {
+		host string
+		want string
+	}{
+		{"www.example.com", "example.com"},
+		{"example.com", "example.com"},
+		{"a.b.example.co.uk", "example.co.uk"},
+		{"foo.co.uk", "foo.co.uk"},
+		{"bucket.s3.amazonaws.com", "bucket.s3.amazonaws.com"},
+		{"xn--bcher-kva.example.com", "example.com"},
+	}
+	for _, tt := range tests {
+		got, err := Registrable(tt.host)
+		if err != nil {
+			t.Errorf("Registrable(%q) failed: %v", tt.host, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Registrable(%q) = %q, want %q", tt.host, got, tt.want)
+		}
+	}
+
+	for _, host := range []string{"co.uk", "github.io", "com"} {
+		if _, err := Registrable(host); err == nil {
+			t.Errorf("Expected public suffix %s to have no registrable domain", host)
+		}
+	}
+}
@@ -57,6 +57,12 @@ func OpenZst(path string) (io.ReadCloser, error) {
 	return &zstdReadCloser{file: file, dec: dec}, nil
 }
 
+// NewZstWriter returns a writer compressing to w. Closing it ends the zstd
+// frame but leaves w open.
+func NewZstWriter(w io.Writer) (io.WriteCloser, error) {
+	return zstd.NewWriter(w)
+}
+
 // CreateZst creates a zstd-compressed file for writing.
 func CreateZst(path string) (io.WriteCloser, error) {
 	file, err := os.Create(path)
@@ -72,3 +78,21 @@ func CreateZst(path string) (io.WriteCloser, error) {
 
 	return &zstdWriteCloser{file: file, enc: enc}, nil
 }
+
+// AppendZst opens a zstd-compressed file for appending, creating it if needed.
+// Each writer produces a separate zstd frame; readers decode concatenated
+// frames as a single stream.
+func AppendZst(path string) (io.WriteCloser, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	enc, err := zstd.NewWriter(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return &zstdWriteCloser{file: file, enc: enc}, nil
+}
@@ -0,0 +1,9 @@
+// Package wordlists embeds the wordlists shipped with nether.
+package wordlists
+
+import _ "embed"
+
+// Quick is the small built-in list of common subdomain labels.
+//
+//go:embed quick.txt
+var Quick string